@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/core"
+	"modular-blockchain-framework/db"
+	"modular-blockchain-framework/modules"
+	"modular-blockchain-framework/rpc"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func main() {
+	defaultPort := os.Getenv("PORT")
+	if defaultPort == "" {
+		defaultPort = "8080"
+	}
+	port := flag.String("port", defaultPort, "RPC listen port")
+	flag.Int("difficulty", 2, "minimum PoW difficulty (leading zero hex digits)")
+	flag.Duration("block-time", 5*time.Second, "PoW target block time")
+	flag.Uint64("retarget-interval", 10, "blocks between PoW difficulty adjustments")
+	flag.Int("miner-threads", runtime.NumCPU(), "PoW mining worker goroutines")
+	flag.String("coinbase", "", "PoW: address credited with block rewards and fees")
+	engineName := flag.String("consensus", "pow", "consensus engine: "+strings.Join(consensus.Engines(), ", "))
+	engineConfig := flag.String("consensus-config", "", "path to a JSON file of consensus engine options; flags override it")
+	flag.String("validators", "", "PoA/BFT: comma-separated validator addresses")
+	validatorKey := flag.String("validator-key", os.Getenv("VALIDATOR_KEY"), "PoA/PoS/BFT: hex private key to seal with (default $VALIDATOR_KEY)")
+	flag.String("peers", "", "BFT: comma-separated base URLs of the other validators' RPC servers")
+	flag.Duration("period", 5*time.Second, "PoA: time between blocks; dev: time between blocks sealed even when empty")
+	flag.Duration("slot-time", 5*time.Second, "PoS: length of a proposer slot (whole seconds)")
+	flag.Uint64("epoch-length", 10, "PoS: blocks between stake distribution refreshes")
+	poolDefaults := core.DefaultMempoolConfig()
+	poolSize := flag.Int("mempool-size", poolDefaults.MaxTxs, "maximum pooled transactions; 0 is unlimited")
+	poolAccountSlots := flag.Int("mempool-account-slots", poolDefaults.MaxPerAccount, "maximum pooled transactions per sender; 0 is unlimited")
+	poolTTL := flag.Duration("mempool-ttl", poolDefaults.TTL, "how long a transaction may stay in the mempool; 0 keeps it indefinitely")
+	priceBump := flag.Int("price-bump", poolDefaults.PriceBump, "percent by which a replacement transaction's gas price must exceed the original's")
+	journalPath := flag.String("mempool-journal", "mempool.journal", "file pooled transactions are kept in across restarts; empty disables it")
+	rejournal := flag.Duration("mempool-rejournal", time.Hour, "how often to compact the mempool journal")
+	backend := flag.String("db", "postgres", "data backend: postgres or memory")
+	genesisPath := flag.String("genesis", "", "path to a genesis JSON file (default: built-in dev genesis)")
+	faucetKey := flag.String("faucet-key", os.Getenv("FAUCET_KEY"), "hex private key of a genesis-funded account the faucet pays from; empty disables the faucet (default $FAUCET_KEY, or the dev faucet key with the built-in genesis)")
+	flag.Parse()
+	if *faucetKey == "" && *genesisPath == "" {
+		*faucetKey = core.DevFaucetKey
+		log.Printf("faucet pays from the public dev account %s; set -faucet-key on any other network", core.DevFaucetAddress)
+	}
+
+	genesis := core.DefaultGenesis()
+	if *genesisPath != "" {
+		g, err := core.LoadGenesis(*genesisPath)
+		if err != nil {
+			log.Fatalf("failed to load genesis: %v", err)
+		}
+		genesis = g
+	}
+
+	switch *backend {
+	case "postgres":
+		db.Init()
+	case "memory":
+		log.Println("running with in-memory backend; blocks will not be persisted")
+	default:
+		log.Fatalf("unknown data backend %q", *backend)
+	}
+
+	chain := core.NewChainWithGenesis(genesis)
+	moduleManager := modules.NewManager()
+	tokens := &modules.TokenModule{}
+	if err := moduleManager.Register(tokens); err != nil {
+		log.Fatalf("failed to register module: %v", err)
+	}
+	if err := moduleManager.Init(chain); err != nil {
+		log.Fatalf("failed to initialise modules: %v", err)
+	}
+	mempool := core.NewMempoolWithConfig(core.MempoolConfig{
+		MaxTxs:        *poolSize,
+		MaxPerAccount: *poolAccountSlots,
+		TTL:           *poolTTL,
+		PriceBump:     *priceBump,
+	})
+	mempool.SetNonceSource(chain.GetNonce)
+	mempool.SetValidator(chain.CheckTxs)
+	chain.Subscribe(mempool.HandleChainEvent)
+	chain.Subscribe(db.PersistChainEvent)
+
+	// the engine must be installed before restoring so fork choice weighs stored blocks
+	options, err := engineOptions(*engineName, *engineConfig, *validatorKey)
+	if err != nil {
+		log.Fatalf("invalid consensus config: %v", err)
+	}
+	engine, err := consensus.New(*engineName, chain, mempool, options)
+	if err != nil {
+		log.Fatalf("failed to create consensus engine: %v", err)
+	}
+
+	blocks, err := db.LoadChain(chain.ChainID())
+	if err != nil {
+		log.Fatalf("failed to load chain: %v", err)
+	}
+	// running on from the last good block would fork from the stored chain
+	if err := chain.Restore(blocks); err != nil {
+		log.Fatalf("failed to restore chain: %v", err)
+	}
+	log.Printf("chain restored at height %d", chain.LatestBlock().Number)
+
+	if *journalPath != "" {
+		if err := mempool.OpenJournal(*journalPath); err != nil {
+			log.Println("warning: mempool journal disabled:", err)
+		}
+	}
+
+	if err := engine.Start(); err != nil {
+		log.Fatalf("failed to start consensus: %v", err)
+	}
+
+	server := rpc.New(chain, mempool)
+	server.SetEngine(engine)
+	server.SetTokens(tokens)
+	if *faucetKey != "" {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(*faucetKey, "0x"))
+		if err != nil {
+			log.Fatalf("invalid faucet key: %v", err)
+		}
+		server.SetFaucetKey(key)
+		if addr := crypto.PubkeyToAddress(key.PublicKey).Hex(); chain.GetBalance(addr) == 0 {
+			log.Printf("warning: faucet account %s has no balance", addr)
+		}
+	}
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("RPC server listening on :%s", *port)
+		errc <- server.Start(":" + *port)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *journalPath != "" && *rejournal > 0 {
+		go func() {
+			ticker := time.NewTicker(*rejournal)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := mempool.RotateJournal(); err != nil {
+						log.Println("warning: failed to compact mempool journal:", err)
+					}
+				}
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		log.Println("shutting down node")
+	case err := <-errc:
+		if err != nil {
+			log.Printf("RPC server failed: %v", err)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("RPC shutdown: %v", err)
+	}
+	if err := engine.Stop(); err != nil {
+		log.Printf("consensus shutdown: %v", err)
+	}
+	if err := mempool.RotateJournal(); err != nil {
+		log.Printf("mempool journal: %v", err)
+	}
+	if err := mempool.CloseJournal(); err != nil {
+		log.Printf("mempool journal: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("db close: %v", err)
+	}
+}
+
+// flagOptions maps command-line flags to the engine options they set.
+var flagOptions = map[string]string{
+	"difficulty":        "difficulty",
+	"block-time":        "blockTime",
+	"retarget-interval": "retargetInterval",
+	"miner-threads":     "threads",
+	"coinbase":          "coinbase",
+	"validators":        "validators",
+	"validator-key":     "validatorKey",
+	"period":            "period",
+	"slot-time":         "slotTime",
+	"epoch-length":      "epochLength",
+	"peers":             "peers",
+}
+
+// engineOptions merges the options file, if any, with the flags given on the
+// command line that the engine understands.
+func engineOptions(engine, path, validatorKey string) (json.RawMessage, error) {
+	_, schema, err := consensus.Describe(engine)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(schema))
+	for _, f := range schema {
+		known[f.Name] = true
+	}
+	options := make(map[string]any)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &options); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		name, ok := flagOptions[f.Name]
+		if !ok || !known[name] {
+			return
+		}
+		switch v := f.Value.(flag.Getter).Get().(type) {
+		case time.Duration:
+			options[name] = v.String()
+		case string:
+			if name == "validators" || name == "peers" {
+				options[name] = splitList(v)
+			} else {
+				options[name] = v
+			}
+		default:
+			options[name] = v
+		}
+	})
+	// the key may come from $VALIDATOR_KEY rather than a flag
+	if _, ok := options["validatorKey"]; !ok && known["validatorKey"] && validatorKey != "" {
+		options["validatorKey"] = validatorKey
+	}
+	return json.Marshal(options)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
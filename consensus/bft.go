@@ -0,0 +1,783 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"modular-blockchain-framework/core"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrMissingCertificate = errors.New("block has no commit certificate")
+	ErrInvalidCertificate = errors.New("invalid commit certificate")
+	ErrInvalidMessage     = errors.New("invalid consensus message")
+)
+
+// MessageType distinguishes BFT messages.
+type MessageType uint8
+
+const (
+	MsgProposal    MessageType = iota + 1 // a proposer's block for a round
+	MsgPrevote                            // first vote of a round
+	MsgPrecommit                          // second vote; a quorum commits the block
+	MsgCommit                             // a committed block with its certificate, for catching up
+	MsgSyncRequest                        // asks peers to rebroadcast commits from Height on
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case MsgProposal:
+		return "proposal"
+	case MsgPrevote:
+		return "prevote"
+	case MsgPrecommit:
+		return "precommit"
+	case MsgCommit:
+		return "commit"
+	case MsgSyncRequest:
+		return "sync"
+	}
+	return fmt.Sprintf("message(%d)", t)
+}
+
+// BFTMessage is a proposal or vote exchanged between BFT validators.
+type BFTMessage struct {
+	Type       MessageType `json:"type"`
+	Height     uint64      `json:"height"`
+	Round      int         `json:"round"`
+	BlockHash  string      `json:"blockHash"`       // empty for a nil vote
+	ValidRound int         `json:"validRound"`      // proposals: round the block last got a prevote quorum, or -1
+	Block      *core.Block `json:"block,omitempty"` // proposals and commits
+	// Justification holds, for a proposal with a ValidRound, the prevotes
+	// for the block in that round, so validators that missed some can accept it.
+	Justification []BFTMessage `json:"justification,omitempty"`
+	From          string       `json:"from"`
+	Signature     string       `json:"signature"` // over SigningHash by From; commits and sync requests are unsigned
+}
+
+// SigningHash is what a validator signs for a proposal or vote.
+func (m *BFTMessage) SigningHash() []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(byte(m.Type))
+	binary.Write(&buf, binary.BigEndian, m.Height)
+	binary.Write(&buf, binary.BigEndian, int64(m.Round))
+	binary.Write(&buf, binary.BigEndian, int64(m.ValidRound))
+	buf.WriteString(m.BlockHash)
+	sum := sha256.Sum256(buf.Bytes())
+	return sum[:]
+}
+
+// SignBFTMessage signs m with key and sets From. Simulations also use it to
+// forge messages from byzantine validators.
+func SignBFTMessage(m *BFTMessage, key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(m.SigningHash(), key)
+	if err != nil {
+		return err
+	}
+	m.From = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	m.Signature = hexutil.Encode(sig)
+	return nil
+}
+
+// BFTConfig configures the BFT engine.
+type BFTConfig struct {
+	Validators       []string      // fixed validator set
+	ProposeTimeout   time.Duration // how long to wait for round 0's proposal
+	PrevoteTimeout   time.Duration // how long to wait for more prevotes after a quorum of any
+	PrecommitTimeout time.Duration // how long to wait for more precommits after a quorum of any
+	TimeoutDelta     time.Duration // added to every timeout per round
+	BlockInterval    time.Duration // pause after a commit before the next height starts
+	Limits           core.BlockLimits
+}
+
+func DefaultBFTConfig(validators []string) BFTConfig {
+	return BFTConfig{
+		Validators:       validators,
+		ProposeTimeout:   3 * time.Second,
+		PrevoteTimeout:   time.Second,
+		PrecommitTimeout: time.Second,
+		TimeoutDelta:     500 * time.Millisecond,
+		BlockInterval:    time.Second,
+		Limits:           core.DefaultBlockLimits(),
+	}
+}
+
+// step is where a validator is within a round.
+type step int
+
+const (
+	stepNewHeight step = iota
+	stepPropose
+	stepPrevote
+	stepPrecommit
+)
+
+type timeoutEvent struct {
+	height uint64
+	round  int
+	step   step
+}
+
+// roundState holds what a validator received in one round.
+type roundState struct {
+	proposal   *BFTMessage
+	prevotes   voteSet
+	precommits voteSet
+
+	prevoteTimer   bool // rule: timeout after a prevote quorum for anything
+	precommitTimer bool // rule: timeout after a precommit quorum for anything
+	polka          bool // rule: lock on the first prevote quorum for the proposal
+}
+
+// BFT finalizes every block with Tendermint-style rounds among a fixed
+// validator set. Each round a rotating proposer broadcasts a block, then
+// validators prevote and precommit; a block is committed once more than two
+// thirds precommit it, and its certificate of those precommits is stored with
+// it. Validators lock on a block once they precommit it, so two blocks can
+// never both be committed at a height while at most a third of the
+// validators are faulty. Rounds that stall time out and move to the next
+// proposer. Committed blocks are final: there are no forks to choose between.
+type BFT struct {
+	chain      *core.Chain
+	mempool    *core.Mempool
+	config     BFTConfig
+	builder    *core.BlockBuilder
+	key        *ecdsa.PrivateKey // nil on nodes that only follow
+	signer     string
+	validators []string // sorted
+	transport  BFTTransport
+
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	inbox    chan BFTMessage
+	timeouts chan timeoutEvent
+	heads    chan core.Block
+
+	// consensus state, owned by the run loop
+	height      uint64
+	round       int
+	step        step
+	lockedRound int
+	lockedBlock *core.Block
+	validRound  int
+	validBlock  *core.Block
+	rounds      map[int]*roundState
+	valid       map[string]bool // proposal validity by block hash
+	future      []BFTMessage    // messages for the next height
+	own         []BFTMessage    // this validator's messages, handled after the current event
+	syncedFrom  uint64
+}
+
+// NewBFT creates a BFT engine that exchanges messages over transport and
+// installs its seal check on the chain. key may be nil for a node that
+// follows committed blocks without voting.
+func NewBFT(c *core.Chain, m *core.Mempool, cfg BFTConfig, key *ecdsa.PrivateKey, transport BFTTransport) *BFT {
+	b := &BFT{
+		chain:     c,
+		mempool:   m,
+		config:    cfg,
+		builder:   core.NewBlockBuilder(c, m, cfg.Limits),
+		key:       key,
+		transport: transport,
+		inbox:     make(chan BFTMessage, 1024),
+		timeouts:  make(chan timeoutEvent, 64),
+		heads:     make(chan core.Block, 64),
+	}
+	for _, v := range cfg.Validators {
+		b.validators = append(b.validators, core.NormalizeAddress(v))
+	}
+	sort.Strings(b.validators)
+	if key != nil {
+		b.signer = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	}
+	c.SetSealVerifier(b)
+	c.Subscribe(b.onChainEvent)
+	return b
+}
+
+func (b *BFT) isValidator(addr string) bool {
+	i := sort.SearchStrings(b.validators, addr)
+	return i < len(b.validators) && b.validators[i] == addr
+}
+
+// quorum is the smallest number of validators that is more than two thirds.
+func (b *BFT) quorum() int { return 2*len(b.validators)/3 + 1 }
+
+// faultTolerance is how many faulty validators the set tolerates.
+func (b *BFT) faultTolerance() int { return (len(b.validators) - 1) / 3 }
+
+// Proposer returns the validator that proposes in the given height and round.
+func (b *BFT) Proposer(height uint64, round int) string {
+	return b.validators[(height+uint64(round))%uint64(len(b.validators))]
+}
+
+// Validators returns the fixed validator set.
+func (b *BFT) Validators() ([]string, error) {
+	return append([]string(nil), b.validators...), nil
+}
+
+// VerifySeal checks that b is signed by a validator and carries a
+// certificate of more than two thirds of the validators' precommits.
+func (b *BFT) VerifySeal(chain core.ChainReader, blk core.Block) error {
+	if err := b.verifySigner(blk); err != nil {
+		return err
+	}
+	return b.verifyCertificate(blk)
+}
+
+// proposalSeal checks a proposal's seal, which has no certificate until the
+// block is committed.
+type proposalSeal struct{ b *BFT }
+
+func (p proposalSeal) VerifySeal(chain core.ChainReader, blk core.Block) error {
+	return p.b.verifySigner(blk)
+}
+
+func (b *BFT) verifySigner(blk core.Block) error {
+	if blk.Nonce != 0 || blk.Target != "" || blk.Candidate != "" || blk.Authorize {
+		return ErrUnexpectedSeal
+	}
+	signer, err := core.RecoverAddress(blk.SigningHash(), blk.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidSignature, err)
+	}
+	if !b.isValidator(signer) {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedSigner, signer)
+	}
+	return nil
+}
+
+func (b *BFT) verifyCertificate(blk core.Block) error {
+	cert := blk.Certificate
+	if cert == nil {
+		return ErrMissingCertificate
+	}
+	if cert.Height != blk.Number || cert.BlockHash != blk.Hash {
+		return fmt.Errorf("%w: for block %d %s", ErrInvalidCertificate, cert.Height, cert.BlockHash)
+	}
+	vote := BFTMessage{Type: MsgPrecommit, Height: cert.Height, Round: cert.Round, BlockHash: cert.BlockHash, ValidRound: -1}
+	hash := vote.SigningHash()
+	signed := make(map[string]bool)
+	for _, cs := range cert.Precommits {
+		signer, err := core.RecoverAddress(hash, cs.Signature)
+		if err != nil || signer != cs.Validator || !b.isValidator(signer) {
+			return fmt.Errorf("%w: bad precommit from %s", ErrInvalidCertificate, cs.Validator)
+		}
+		signed[signer] = true
+	}
+	if len(signed) < b.quorum() {
+		return fmt.Errorf("%w: %d of %d precommits, need %d", ErrInvalidCertificate, len(signed), len(b.validators), b.quorum())
+	}
+	return nil
+}
+
+func (b *BFT) ValidateBlock(blk core.Block) error {
+	return b.chain.ValidateBlock(blk)
+}
+
+// ProposeBlock builds an unsigned block on the head from txs. Blocks only
+// enter the chain through consensus rounds.
+func (b *BFT) ProposeBlock(txs []core.Transaction) (core.Block, error) {
+	block, _ := b.builder.BuildFrom(txs, time.Now().Unix())
+	return block, nil
+}
+
+// Seal signs b's header with the validator key and sets its hash. The block
+// still needs a certificate before the chain accepts it.
+func (b *BFT) Seal(blk *core.Block) error {
+	if b.key == nil {
+		return errors.New("bft: no validator key configured")
+	}
+	sig, err := crypto.Sign(blk.SigningHash(), b.key)
+	if err != nil {
+		return err
+	}
+	blk.Signature = hexutil.Encode(sig)
+	blk.Hash = blk.ComputeHash()
+	return nil
+}
+
+// HandleMessage delivers a message from the network to the engine.
+func (b *BFT) HandleMessage(m BFTMessage) {
+	select {
+	case b.inbox <- m:
+	default:
+		log.Println("bft: inbox full, dropping", m.Type, "from", m.From)
+	}
+}
+
+func (b *BFT) onChainEvent(ev core.ChainEvent) {
+	select {
+	case b.heads <- ev.Added[len(ev.Added)-1]:
+	default:
+	}
+}
+
+// Start launches the consensus loop. Calling it on a running engine is a no-op.
+func (b *BFT) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b.ctx, b.cancel = ctx, cancel
+	b.done = make(chan struct{})
+	go b.run(ctx, b.done)
+	return nil
+}
+
+// Stop halts the consensus loop and waits for it to exit. Calling it on a
+// stopped engine is a no-op.
+func (b *BFT) Stop() error {
+	b.mu.Lock()
+	cancel, done := b.cancel, b.done
+	b.cancel, b.done = nil, nil
+	b.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+func (b *BFT) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	b.enterHeight(b.chain.LatestBlock().Number+1, 0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-b.inbox:
+			b.receive(m)
+		case ev := <-b.timeouts:
+			b.onTimeout(ev)
+		case head := <-b.heads:
+			if head.Number >= b.height {
+				b.enterHeight(head.Number+1, b.config.BlockInterval)
+			}
+		}
+		for len(b.own) > 0 {
+			m := b.own[0]
+			b.own = b.own[1:]
+			b.receive(m)
+		}
+	}
+}
+
+func (b *BFT) schedule(d time.Duration, ev timeoutEvent) {
+	b.mu.Lock()
+	ctx := b.ctx
+	b.mu.Unlock()
+	time.AfterFunc(d, func() {
+		select {
+		case b.timeouts <- ev:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (b *BFT) timeout(base time.Duration, round int) time.Duration {
+	return base + time.Duration(round)*b.config.TimeoutDelta
+}
+
+// enterHeight resets the round state for a new height and starts round 0
+// after delay.
+func (b *BFT) enterHeight(height uint64, delay time.Duration) {
+	b.height, b.round, b.step = height, 0, stepNewHeight
+	b.lockedRound, b.lockedBlock = -1, nil
+	b.validRound, b.validBlock = -1, nil
+	b.rounds = make(map[int]*roundState)
+	b.valid = make(map[string]bool)
+	b.own = nil
+	b.schedule(delay, timeoutEvent{height: height, step: stepNewHeight})
+
+	future := b.future
+	b.future = nil
+	for _, m := range future {
+		b.receive(m)
+	}
+}
+
+func (b *BFT) roundState(r int) *roundState {
+	rs, ok := b.rounds[r]
+	if !ok {
+		rs = &roundState{prevotes: make(voteSet), precommits: make(voteSet)}
+		b.rounds[r] = rs
+	}
+	return rs
+}
+
+func (b *BFT) startRound(r int) {
+	b.round, b.step = r, stepPropose
+	if b.key != nil && b.Proposer(b.height, r) == b.signer {
+		block := b.validBlock
+		if block == nil {
+			built, err := b.newBlock()
+			if err != nil {
+				log.Println("bft: cannot build proposal:", err)
+			} else {
+				block = &built
+			}
+		}
+		if block != nil {
+			m := BFTMessage{Type: MsgProposal, Height: b.height, Round: r, BlockHash: block.Hash, ValidRound: b.validRound, Block: block}
+			if b.validRound >= 0 {
+				for _, votes := range b.roundState(b.validRound).prevotes {
+					if v, ok := votes[block.Hash]; ok {
+						m.Justification = append(m.Justification, v)
+					}
+				}
+			}
+			b.broadcast(m)
+		}
+	}
+	b.schedule(b.timeout(b.config.ProposeTimeout, r), timeoutEvent{height: b.height, round: r, step: stepPropose})
+	b.evaluate()
+}
+
+func (b *BFT) newBlock() (core.Block, error) {
+	parent := b.chain.LatestBlock()
+	block, _ := b.builder.Build(max(time.Now().Unix(), parent.Timestamp))
+	if block.Number != b.height {
+		return core.Block{}, fmt.Errorf("head moved to %d", parent.Number)
+	}
+	err := b.Seal(&block)
+	return block, err
+}
+
+// broadcast signs m and sends it to the other validators. It is handled
+// locally once the current event is done, so rules never run re-entrantly.
+func (b *BFT) broadcast(m BFTMessage) {
+	if err := SignBFTMessage(&m, b.key); err != nil {
+		log.Println("bft: signing failed:", err)
+		return
+	}
+	if b.transport != nil {
+		b.transport.Broadcast(m)
+	}
+	b.own = append(b.own, m)
+}
+
+func (b *BFT) vote(t MessageType, hash string) {
+	if b.key == nil || !b.isValidator(b.signer) {
+		return
+	}
+	b.broadcast(BFTMessage{Type: t, Height: b.height, Round: b.round, BlockHash: hash, ValidRound: -1})
+}
+
+// receive records a message and applies whichever rules it triggers.
+func (b *BFT) receive(m BFTMessage) {
+	switch m.Type {
+	case MsgCommit:
+		b.receiveCommit(m)
+		return
+	case MsgSyncRequest:
+		b.serveSync(m.Height)
+		return
+	}
+	if m.Height > b.height {
+		if m.Height == b.height+1 {
+			b.future = append(b.future, m)
+		}
+		return
+	}
+	if m.Height < b.height || b.rounds == nil || m.Round < 0 {
+		return
+	}
+	if err := b.checkMessage(m); err != nil {
+		log.Println("bft: dropping", m.Type, "from", m.From+":", err)
+		return
+	}
+	rs := b.roundState(m.Round)
+	switch m.Type {
+	case MsgProposal:
+		if rs.proposal != nil {
+			return
+		}
+		rs.proposal = &m
+		for _, v := range m.Justification {
+			if v.Type == MsgPrevote && v.Height == m.Height && v.Round == m.ValidRound && v.BlockHash == m.BlockHash && b.checkMessage(v) == nil {
+				b.roundState(v.Round).prevotes.add(v)
+			}
+		}
+	case MsgPrevote:
+		if !rs.prevotes.add(m) {
+			return
+		}
+	case MsgPrecommit:
+		if !rs.precommits.add(m) {
+			return
+		}
+	default:
+		return
+	}
+	b.evaluate()
+}
+
+func (b *BFT) checkMessage(m BFTMessage) error {
+	if !b.isValidator(m.From) {
+		return fmt.Errorf("%w: %s is not a validator", ErrInvalidMessage, m.From)
+	}
+	signer, err := core.RecoverAddress(m.SigningHash(), m.Signature)
+	if err != nil || signer != m.From {
+		return fmt.Errorf("%w: bad signature", ErrInvalidMessage)
+	}
+	if m.Type != MsgProposal {
+		return nil
+	}
+	if m.From != b.Proposer(m.Height, m.Round) {
+		return fmt.Errorf("%w: not the proposer of round %d", ErrInvalidMessage, m.Round)
+	}
+	if m.Block == nil || m.Block.Hash != m.BlockHash || m.Block.Number != m.Height {
+		return fmt.Errorf("%w: proposal does not match its block", ErrInvalidMessage)
+	}
+	if m.ValidRound >= m.Round {
+		return fmt.Errorf("%w: valid round %d not before round %d", ErrInvalidMessage, m.ValidRound, m.Round)
+	}
+	return nil
+}
+
+// validProposal reports whether a proposed block extends the head and passes
+// the chain's checks.
+func (b *BFT) validProposal(blk *core.Block) bool {
+	if ok, seen := b.valid[blk.Hash]; seen {
+		return ok
+	}
+	ok := blk.PrevHash == b.chain.LatestBlock().Hash
+	if ok {
+		if err := b.chain.ValidateBlockWithSeal(*blk, proposalSeal{b}); err != nil {
+			log.Println("bft: invalid proposal:", err)
+			ok = false
+		}
+	}
+	b.valid[blk.Hash] = ok
+	return ok
+}
+
+// voteSet holds one kind of vote in a round, by validator and block hash.
+// An equivocating validator's conflicting votes are all kept and each counts
+// toward its own block; that is safe while at most a third are faulty, and
+// it keeps honest validators from being stuck on whichever vote arrived first.
+type voteSet map[string]map[string]BFTMessage
+
+// add records a vote and reports whether it was new.
+func (vs voteSet) add(m BFTMessage) bool {
+	if vs[m.From] == nil {
+		vs[m.From] = make(map[string]BFTMessage)
+	}
+	if _, ok := vs[m.From][m.BlockHash]; ok {
+		return false
+	}
+	if len(vs[m.From]) > 0 {
+		log.Printf("bft: %s equivocated in round %d", m.From, m.Round)
+	}
+	vs[m.From][m.BlockHash] = m
+	return true
+}
+
+// count returns how many validators voted for hash.
+func (vs voteSet) count(hash string) int {
+	n := 0
+	for _, votes := range vs {
+		if _, ok := votes[hash]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// evaluate applies the Tendermint state transition rules until none fires.
+func (b *BFT) evaluate() {
+	if b.step == stepNewHeight {
+		return
+	}
+	for b.applyRules() {
+	}
+}
+
+func (b *BFT) applyRules() bool {
+	q := b.quorum()
+
+	// decide: a precommit quorum for a proposal in any round commits it
+	for r, rs := range b.rounds {
+		if rs.proposal != nil && rs.precommits.count(rs.proposal.BlockHash) >= q && b.validProposal(rs.proposal.Block) {
+			b.commit(r, rs)
+			return false
+		}
+	}
+
+	// skip ahead once more than f validators are in a later round
+	for r, rs := range b.rounds {
+		if r <= b.round {
+			continue
+		}
+		senders := make(map[string]bool)
+		for v := range rs.prevotes {
+			senders[v] = true
+		}
+		for v := range rs.precommits {
+			senders[v] = true
+		}
+		if rs.proposal != nil {
+			senders[rs.proposal.From] = true
+		}
+		if len(senders) > b.faultTolerance() {
+			b.startRound(r)
+			return false
+		}
+	}
+
+	rs := b.roundState(b.round)
+	p := rs.proposal
+
+	if b.step == stepPropose && p != nil {
+		if p.ValidRound == -1 {
+			if b.validProposal(p.Block) && (b.lockedRound == -1 || b.lockedBlock.Hash == p.BlockHash) {
+				b.prevote(p.BlockHash)
+			} else {
+				b.prevote("")
+			}
+			return true
+		}
+		if vr, ok := b.rounds[p.ValidRound]; ok && vr.prevotes.count(p.BlockHash) >= q {
+			if b.validProposal(p.Block) && (b.lockedRound <= p.ValidRound || b.lockedBlock.Hash == p.BlockHash) {
+				b.prevote(p.BlockHash)
+			} else {
+				b.prevote("")
+			}
+			return true
+		}
+	}
+
+	if b.step == stepPrevote && len(rs.prevotes) >= q && !rs.prevoteTimer {
+		rs.prevoteTimer = true
+		b.schedule(b.timeout(b.config.PrevoteTimeout, b.round), timeoutEvent{height: b.height, round: b.round, step: stepPrevote})
+	}
+
+	if b.step >= stepPrevote && p != nil && !rs.polka && rs.prevotes.count(p.BlockHash) >= q && b.validProposal(p.Block) {
+		rs.polka = true
+		if b.step == stepPrevote {
+			b.lockedRound, b.lockedBlock = b.round, p.Block
+			b.precommit(p.BlockHash)
+		}
+		b.validRound, b.validBlock = b.round, p.Block
+		return true
+	}
+
+	if b.step == stepPrevote && rs.prevotes.count("") >= q {
+		b.precommit("")
+		return true
+	}
+
+	if len(rs.precommits) >= q && !rs.precommitTimer {
+		rs.precommitTimer = true
+		b.schedule(b.timeout(b.config.PrecommitTimeout, b.round), timeoutEvent{height: b.height, round: b.round, step: stepPrecommit})
+	}
+	return false
+}
+
+func (b *BFT) prevote(hash string) {
+	b.step = stepPrevote
+	b.vote(MsgPrevote, hash)
+}
+
+func (b *BFT) precommit(hash string) {
+	b.step = stepPrecommit
+	b.vote(MsgPrecommit, hash)
+}
+
+func (b *BFT) onTimeout(ev timeoutEvent) {
+	if ev.height != b.height {
+		return
+	}
+	switch {
+	case ev.step == stepNewHeight && b.step == stepNewHeight:
+		b.startRound(ev.round)
+	case ev.round != b.round:
+	case ev.step == stepPropose && b.step == stepPropose:
+		b.prevote("")
+		b.evaluate()
+	case ev.step == stepPrevote && b.step == stepPrevote:
+		b.precommit("")
+		b.evaluate()
+	case ev.step == stepPrecommit:
+		b.startRound(b.round + 1)
+	}
+}
+
+// commit attaches the certificate to the decided block, adds it to the chain
+// and announces it to validators that missed the round.
+func (b *BFT) commit(round int, rs *roundState) {
+	block := *rs.proposal.Block
+	cert := &core.CommitCertificate{Height: block.Number, Round: round, BlockHash: block.Hash}
+	for _, v := range b.validators {
+		if pc, ok := rs.precommits[v][block.Hash]; ok {
+			cert.Precommits = append(cert.Precommits, core.CommitSig{Validator: v, Signature: pc.Signature})
+		}
+	}
+	block.Certificate = cert
+	b.step = stepNewHeight
+	if err := b.chain.AddBlock(block); err != nil && !errors.Is(err, core.ErrKnownBlock) {
+		// stay at this height with the locks kept; the next round decides
+		// again and retries the commit
+		log.Println("bft: committed block rejected:", err)
+		b.schedule(b.config.BlockInterval, timeoutEvent{height: b.height, round: b.round + 1, step: stepNewHeight})
+		return
+	}
+	b.mempool.ClearMined(block.Transactions)
+	fmt.Println("Committed block", block.Number, block.Hash, "in round", round)
+	if b.transport != nil {
+		b.transport.Broadcast(BFTMessage{Type: MsgCommit, Height: block.Number, Block: &block})
+	}
+	b.enterHeight(block.Number+1, b.config.BlockInterval)
+}
+
+// receiveCommit imports a block committed by others. A gap in heights is
+// filled by asking peers to resend their commits.
+func (b *BFT) receiveCommit(m BFTMessage) {
+	if m.Block == nil {
+		return
+	}
+	head := b.chain.LatestBlock()
+	if m.Block.Number <= head.Number {
+		return
+	}
+	if m.Block.Number > head.Number+1 {
+		if b.syncedFrom != head.Number+1 && b.transport != nil {
+			b.syncedFrom = head.Number + 1
+			b.transport.Broadcast(BFTMessage{Type: MsgSyncRequest, Height: head.Number + 1})
+		}
+		return
+	}
+	if err := b.chain.AddBlock(*m.Block); err != nil && !errors.Is(err, core.ErrKnownBlock) {
+		log.Println("bft: commit rejected:", err)
+	}
+}
+
+// serveSync rebroadcasts committed blocks from height on.
+func (b *BFT) serveSync(height uint64) {
+	if b.transport == nil {
+		return
+	}
+	blocks := b.chain.CanonicalBlocks()
+	for i := height; i < uint64(len(blocks)); i++ {
+		blk := blocks[i]
+		b.transport.Broadcast(BFTMessage{Type: MsgCommit, Height: blk.Number, Block: &blk})
+	}
+}
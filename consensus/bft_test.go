@@ -0,0 +1,173 @@
+package consensus_test
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type bftNode struct {
+	name   string
+	chain  *core.Chain
+	engine *consensus.BFT
+}
+
+// newBFTNetwork creates n validators on a MessageBus with short timeouts.
+// They start once the test has set up the bus.
+func newBFTNetwork(t *testing.T, n int) (*consensus.MessageBus, []*ecdsa.PrivateKey, []*bftNode) {
+	t.Helper()
+	keys := make([]*ecdsa.PrivateKey, n)
+	validators := make([]string, n)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		validators[i] = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	}
+	cfg := consensus.DefaultBFTConfig(validators)
+	cfg.ProposeTimeout = 300 * time.Millisecond
+	cfg.PrevoteTimeout = 100 * time.Millisecond
+	cfg.PrecommitTimeout = 100 * time.Millisecond
+	cfg.TimeoutDelta = 50 * time.Millisecond
+	cfg.BlockInterval = 10 * time.Millisecond
+
+	bus := consensus.NewMessageBus()
+	nodes := make([]*bftNode, n)
+	for i, key := range keys {
+		node := &bftNode{name: validators[i], chain: core.NewChain()}
+		transport := bus.Join(node.name, func(m consensus.BFTMessage) { node.engine.HandleMessage(m) })
+		node.engine = consensus.NewBFT(node.chain, core.NewMempool(), cfg, key, transport)
+		nodes[i] = node
+	}
+	return bus, keys, nodes
+}
+
+func startAll(t *testing.T, nodes []*bftNode) {
+	t.Helper()
+	for _, node := range nodes {
+		if err := node.engine.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { node.engine.Stop() })
+	}
+}
+
+// waitForHeight waits until every node has committed height.
+func waitForHeight(t *testing.T, nodes []*bftNode, height uint64) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for _, node := range nodes {
+		for node.chain.LatestBlock().Number < height {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s stuck at height %d, want %d", node.name, node.chain.LatestBlock().Number, height)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// checkAgreement checks that the nodes committed the same blocks up to
+// height, each with a certificate the others accept.
+func checkAgreement(t *testing.T, nodes []*bftNode, height uint64) {
+	t.Helper()
+	want := nodes[0].chain.CanonicalBlocks()
+	for _, node := range nodes {
+		blocks := node.chain.CanonicalBlocks()
+		for h := uint64(1); h <= height; h++ {
+			if blocks[h].Hash != want[h].Hash {
+				t.Fatalf("height %d: %s committed %s, %s committed %s", h, node.name, blocks[h].Hash, nodes[0].name, want[h].Hash)
+			}
+			for _, other := range nodes {
+				if err := other.engine.VerifySeal(other.chain, blocks[h]); err != nil {
+					t.Fatalf("height %d: certificate from %s rejected by %s: %v", h, node.name, other.name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestBFTCommitsWithCrashedValidator(t *testing.T) {
+	bus, _, nodes := newBFTNetwork(t, 4)
+	bus.Crash(nodes[3].name)
+	startAll(t, nodes)
+	live := nodes[:3]
+
+	const height = 5
+	waitForHeight(t, live, height)
+	checkAgreement(t, live, height)
+	for h, b := range live[0].chain.CanonicalBlocks()[1 : height+1] {
+		for _, cs := range b.Certificate.Precommits {
+			if cs.Validator == nodes[3].name {
+				t.Fatalf("height %d: certificate holds a precommit from the crashed validator", h+1)
+			}
+		}
+	}
+	if got := nodes[3].chain.LatestBlock().Number; got != 0 {
+		t.Errorf("crashed validator committed up to height %d on its own", got)
+	}
+
+	// a block only enters the chain with its certificate
+	uncertified := live[0].chain.CanonicalBlocks()[1]
+	uncertified.Certificate = nil
+	if err := nodes[3].chain.AddBlock(uncertified); !errors.Is(err, consensus.ErrMissingCertificate) {
+		t.Errorf("block without certificate: got %v, want %v", err, consensus.ErrMissingCertificate)
+	}
+}
+
+func TestBFTSafeWithEquivocator(t *testing.T) {
+	bus, keys, nodes := newBFTNetwork(t, 4)
+	// validator 0 sends conflicting votes to validators 2 and 3
+	bus.Intercept(consensus.Equivocator(keys[0], map[string]bool{nodes[2].name: true, nodes[3].name: true}))
+	startAll(t, nodes)
+
+	const height = 5
+	waitForHeight(t, nodes, height)
+	checkAgreement(t, nodes, height)
+}
+
+// rejectOnce fails the first certified block at height it is asked to
+// verify, as a chain would whose commit fails for a transient reason.
+type rejectOnce struct {
+	*consensus.BFT
+	height   uint64
+	rejected atomic.Bool
+}
+
+var errRejected = errors.New("commit rejected by test")
+
+func (r *rejectOnce) VerifySeal(chain core.ChainReader, blk core.Block) error {
+	if blk.Number == r.height && blk.Certificate != nil && r.rejected.CompareAndSwap(false, true) {
+		return errRejected
+	}
+	return r.BFT.VerifySeal(chain, blk)
+}
+
+func TestBFTRetriesRejectedCommit(t *testing.T) {
+	_, _, nodes := newBFTNetwork(t, 4)
+	// every validator fails its first commit at height 2, so none can
+	// learn the block from another
+	seals := make([]*rejectOnce, len(nodes))
+	for i, node := range nodes {
+		seals[i] = &rejectOnce{BFT: node.engine, height: 2}
+		node.chain.SetSealVerifier(seals[i])
+	}
+	startAll(t, nodes)
+
+	const height = 4
+	waitForHeight(t, nodes, height)
+	checkAgreement(t, nodes, height)
+	for i, seal := range seals {
+		if !seal.rejected.Load() {
+			t.Errorf("%s never had its commit rejected", nodes[i].name)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// BFTTransport carries BFT messages to the other validators. Delivery is
+// best effort; the rounds' timeouts cover lost messages.
+type BFTTransport interface {
+	Broadcast(m BFTMessage)
+}
+
+// MessageBus is an in-process network of BFT validators for simulations and
+// tests. Members can be crashed, and an interceptor can drop, rewrite or add
+// messages in flight to play byzantine validators.
+type MessageBus struct {
+	mu        sync.Mutex
+	members   map[string]func(BFTMessage)
+	order     []string
+	crashed   map[string]bool
+	intercept func(from, to string, m BFTMessage) []BFTMessage
+	latency   time.Duration
+}
+
+func NewMessageBus() *MessageBus {
+	return &MessageBus{members: make(map[string]func(BFTMessage)), crashed: make(map[string]bool)}
+}
+
+// Join connects a member that receives messages through deliver, usually
+// (*BFT).HandleMessage, and returns the transport it sends with.
+func (b *MessageBus) Join(name string, deliver func(BFTMessage)) BFTTransport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.members[name]; !ok {
+		b.order = append(b.order, name)
+	}
+	b.members[name] = deliver
+	return busTransport{bus: b, from: name}
+}
+
+// Crash cuts a member off: it neither sends nor receives until Recover.
+func (b *MessageBus) Crash(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.crashed[name] = true
+}
+
+func (b *MessageBus) Recover(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.crashed, name)
+}
+
+// Intercept installs fn to decide what each member receives in place of m:
+// nil drops it, several messages deliver them all. Passing nil removes it.
+func (b *MessageBus) Intercept(fn func(from, to string, m BFTMessage) []BFTMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.intercept = fn
+}
+
+// SetLatency delays every delivery by d.
+func (b *MessageBus) SetLatency(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latency = d
+}
+
+func (b *MessageBus) send(from string, m BFTMessage) {
+	b.mu.Lock()
+	if b.crashed[from] {
+		b.mu.Unlock()
+		return
+	}
+	type delivery struct {
+		deliver func(BFTMessage)
+		msgs    []BFTMessage
+	}
+	var out []delivery
+	for _, to := range b.order {
+		if to == from || b.crashed[to] {
+			continue
+		}
+		msgs := []BFTMessage{m}
+		if b.intercept != nil {
+			msgs = b.intercept(from, to, m)
+		}
+		out = append(out, delivery{b.members[to], msgs})
+	}
+	latency := b.latency
+	b.mu.Unlock()
+
+	for _, d := range out {
+		d := d
+		go func() {
+			if latency > 0 {
+				time.Sleep(latency)
+			}
+			for _, msg := range d.msgs {
+				d.deliver(msg)
+			}
+		}()
+	}
+}
+
+type busTransport struct {
+	bus  *MessageBus
+	from string
+}
+
+func (t busTransport) Broadcast(m BFTMessage) { t.bus.send(t.from, m) }
+
+// HTTPTransport posts messages as JSON to the /bftMessage endpoint of peer nodes.
+type HTTPTransport struct {
+	Peers  []string // base URLs, e.g. http://10.0.0.2:8080
+	Client *http.Client
+}
+
+func NewHTTPTransport(peers []string) *HTTPTransport {
+	return &HTTPTransport{Peers: peers, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (t *HTTPTransport) Broadcast(m BFTMessage) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		log.Println("bft: cannot encode message:", err)
+		return
+	}
+	for _, peer := range t.Peers {
+		go func(url string) {
+			resp, err := t.Client.Post(url, "application/json", bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+		}(strings.TrimSuffix(peer, "/") + "/bftMessage")
+	}
+}
+
+// Equivocator returns an interceptor that makes the validator holding key
+// vote both ways: members in split receive a conflicting vote signed with the
+// same key (nil instead of a block, a bogus block instead of nil), the rest
+// its real vote.
+func Equivocator(key *ecdsa.PrivateKey, split map[string]bool) func(from, to string, m BFTMessage) []BFTMessage {
+	signer := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	return func(from, to string, m BFTMessage) []BFTMessage {
+		if m.From != signer || !split[to] || (m.Type != MsgPrevote && m.Type != MsgPrecommit) {
+			return []BFTMessage{m}
+		}
+		forged := m
+		forged.BlockHash = ""
+		if m.BlockHash == "" {
+			forged.BlockHash = strings.Repeat("0", 64)
+		}
+		if err := SignBFTMessage(&forged, key); err != nil {
+			return []BFTMessage{m}
+		}
+		return []BFTMessage{forged}
+	}
+}
@@ -0,0 +1,163 @@
+package consensus
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Options of the built-in engines, as accepted by New.
+
+type PoWOptions struct {
+	Difficulty       int      `json:"difficulty" desc:"minimum difficulty in leading zero hex digits"`
+	BlockTime        Duration `json:"blockTime" desc:"target time between blocks"`
+	RetargetInterval uint64   `json:"retargetInterval" desc:"blocks between difficulty adjustments"`
+	Threads          int      `json:"threads" desc:"mining worker goroutines"`
+	Coinbase         string   `json:"coinbase" desc:"address credited with block rewards and fees; empty mines for nobody"`
+}
+
+type PoAOptions struct {
+	Validators   []string `json:"validators" desc:"initial validator addresses"`
+	ValidatorKey string   `json:"validatorKey" desc:"hex private key to seal with; empty to only validate"`
+	Period       Duration `json:"period" desc:"time between blocks"`
+}
+
+type PoSOptions struct {
+	ValidatorKey string   `json:"validatorKey" desc:"hex private key to propose with; empty to only validate"`
+	SlotTime     Duration `json:"slotTime" desc:"length of a proposer slot, whole seconds"`
+	EpochLength  uint64   `json:"epochLength" desc:"blocks between stake distribution refreshes"`
+}
+
+type DevOptions struct {
+	Period    Duration `json:"period" desc:"also seal a block this often, empty or not; 0 seals only on new transactions and dev_mine"`
+	Timestamp int64    `json:"timestamp" desc:"pin the clock to this Unix time; 0 follows the local clock"`
+}
+
+type BFTOptions struct {
+	Validators       []string `json:"validators" desc:"fixed validator addresses"`
+	ValidatorKey     string   `json:"validatorKey" desc:"hex private key to vote with; empty to only follow"`
+	Peers            []string `json:"peers" desc:"RPC base URLs of the other validators"`
+	ProposeTimeout   Duration `json:"proposeTimeout"`
+	PrevoteTimeout   Duration `json:"prevoteTimeout"`
+	PrecommitTimeout Duration `json:"precommitTimeout"`
+	BlockInterval    Duration `json:"blockInterval" desc:"pause after a commit before the next height"`
+}
+
+func init() {
+	Register(Registration{
+		Name:        "pow",
+		Description: "proof of work with periodic difficulty retargeting",
+		Config: func() any {
+			return &PoWOptions{Difficulty: 2, BlockTime: Duration(5 * time.Second), RetargetInterval: 10, Threads: runtime.NumCPU()}
+		},
+		New: func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error) {
+			opts := config.(*PoWOptions)
+			if opts.Coinbase != "" && !common.IsHexAddress(opts.Coinbase) {
+				return nil, fmt.Errorf("pow: invalid coinbase %q", opts.Coinbase)
+			}
+			cfg := DefaultPoWConfig(opts.Difficulty)
+			cfg.TargetBlockTime = time.Duration(opts.BlockTime)
+			cfg.RetargetInterval = opts.RetargetInterval
+			cfg.Threads = opts.Threads
+			cfg.Coinbase = opts.Coinbase
+			return NewPoWWithConfig(c, m, cfg), nil
+		},
+	})
+	Register(Registration{
+		Name:        "poa",
+		Description: "Clique-style proof of authority with validator voting",
+		Config:      func() any { return &PoAOptions{Period: Duration(5 * time.Second)} },
+		New: func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error) {
+			opts := config.(*PoAOptions)
+			if len(opts.Validators) == 0 {
+				return nil, errors.New("poa: validators are required")
+			}
+			key, err := parseKey(opts.ValidatorKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg := DefaultPoAConfig(opts.Validators)
+			cfg.Period = time.Duration(opts.Period)
+			return NewPoA(c, m, cfg, key), nil
+		},
+	})
+	Register(Registration{
+		Name:        "pos",
+		Description: "proof of stake with stake-weighted proposers and slashing",
+		Config: func() any {
+			return &PoSOptions{SlotTime: Duration(5 * time.Second), EpochLength: 10}
+		},
+		New: func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error) {
+			opts := config.(*PoSOptions)
+			key, err := parseKey(opts.ValidatorKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg := DefaultPoSConfig()
+			cfg.SlotTime = time.Duration(opts.SlotTime)
+			cfg.EpochLength = opts.EpochLength
+			return NewPoS(c, m, cfg, key), nil
+		},
+	})
+	Register(Registration{
+		Name:        "dev",
+		Description: "instant sealing for local development and tests",
+		Config:      func() any { return &DevOptions{} },
+		New: func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error) {
+			opts := config.(*DevOptions)
+			cfg := DefaultDevConfig()
+			cfg.Period = time.Duration(opts.Period)
+			cfg.Timestamp = opts.Timestamp
+			return NewDev(c, m, cfg), nil
+		},
+	})
+	Register(Registration{
+		Name:        "bft",
+		Description: "Tendermint-style BFT rounds with instant finality",
+		Config: func() any {
+			d := DefaultBFTConfig(nil)
+			return &BFTOptions{
+				ProposeTimeout:   Duration(d.ProposeTimeout),
+				PrevoteTimeout:   Duration(d.PrevoteTimeout),
+				PrecommitTimeout: Duration(d.PrecommitTimeout),
+				BlockInterval:    Duration(d.BlockInterval),
+			}
+		},
+		New: func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error) {
+			opts := config.(*BFTOptions)
+			if len(opts.Validators) == 0 {
+				return nil, errors.New("bft: validators are required")
+			}
+			key, err := parseKey(opts.ValidatorKey)
+			if err != nil {
+				return nil, err
+			}
+			cfg := DefaultBFTConfig(opts.Validators)
+			cfg.ProposeTimeout = time.Duration(opts.ProposeTimeout)
+			cfg.PrevoteTimeout = time.Duration(opts.PrevoteTimeout)
+			cfg.PrecommitTimeout = time.Duration(opts.PrecommitTimeout)
+			cfg.BlockInterval = time.Duration(opts.BlockInterval)
+			return NewBFT(c, m, cfg, key, NewHTTPTransport(opts.Peers)), nil
+		},
+	})
+}
+
+// parseKey decodes an optional hex private key.
+func parseKey(hex string) (*ecdsa.PrivateKey, error) {
+	if hex == "" {
+		return nil, nil
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator key: %w", err)
+	}
+	return key, nil
+}
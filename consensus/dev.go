@@ -0,0 +1,221 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"modular-blockchain-framework/core"
+	"sync"
+	"time"
+)
+
+// DevConfig configures the dev engine.
+type DevConfig struct {
+	Period    time.Duration // also seal a block this often, empty or not; 0 disables
+	Timestamp int64         // pins the clock to this Unix time; 0 follows the local clock
+	Limits    core.BlockLimits
+}
+
+func DefaultDevConfig() DevConfig {
+	return DevConfig{Limits: core.DefaultBlockLimits()}
+}
+
+// Dev seals blocks instantly for local development and tests: whenever a
+// transaction enters the mempool, on every Period if set, and on demand
+// through Mine. Blocks carry no seal. The engine keeps its own clock, which
+// tests can pin and advance to control block timestamps; the chain checks
+// timestamps against it too.
+type Dev struct {
+	chain   *core.Chain
+	mempool *core.Mempool
+	config  DevConfig
+	builder *core.BlockBuilder
+	wake    chan struct{}
+
+	sealMu sync.Mutex // serialises sealing
+
+	clockMu sync.Mutex
+	pinned  time.Time     // zero when following the local clock
+	offset  time.Duration // added to the local clock when not pinned
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDev creates a dev engine and installs its seal check on the chain.
+func NewDev(c *core.Chain, m *core.Mempool, cfg DevConfig) *Dev {
+	d := &Dev{
+		chain:   c,
+		mempool: m,
+		config:  cfg,
+		builder: core.NewBlockBuilder(c, m, cfg.Limits),
+		wake:    make(chan struct{}, 1),
+	}
+	if cfg.Timestamp != 0 {
+		d.pinned = time.Unix(cfg.Timestamp, 0)
+	}
+	c.SetSealVerifier(d)
+	m.Subscribe(func(core.Transaction) {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	})
+	return d
+}
+
+// Now is the engine's clock.
+func (d *Dev) Now() time.Time {
+	d.clockMu.Lock()
+	defer d.clockMu.Unlock()
+	if !d.pinned.IsZero() {
+		return d.pinned
+	}
+	return time.Now().Add(d.offset)
+}
+
+// SetTime pins the clock to the Unix time ts. It stays there until moved by
+// SetTime or IncreaseTime.
+func (d *Dev) SetTime(ts int64) {
+	d.clockMu.Lock()
+	defer d.clockMu.Unlock()
+	d.pinned = time.Unix(ts, 0)
+}
+
+// IncreaseTime moves the clock forward by delta.
+func (d *Dev) IncreaseTime(delta time.Duration) {
+	d.clockMu.Lock()
+	defer d.clockMu.Unlock()
+	if d.pinned.IsZero() {
+		d.offset += delta
+	} else {
+		d.pinned = d.pinned.Add(delta)
+	}
+}
+
+// VerifySeal rejects blocks that carry seal fields; dev blocks have none.
+func (d *Dev) VerifySeal(chain core.ChainReader, b core.Block) error {
+	if b.Nonce != 0 || b.Target != "" || b.Signature != "" || b.Candidate != "" || b.Authorize {
+		return ErrUnexpectedSeal
+	}
+	return nil
+}
+
+func (d *Dev) ValidateBlock(b core.Block) error {
+	return d.chain.ValidateBlock(b)
+}
+
+// ProposeBlock builds a block on the head from txs, timestamped by the
+// engine's clock.
+func (d *Dev) ProposeBlock(txs []core.Transaction) (core.Block, error) {
+	block, _ := d.builder.BuildFrom(txs, d.Now().Unix())
+	return block, nil
+}
+
+// Seal sets b's hash; there is nothing else to seal.
+func (d *Dev) Seal(b *core.Block) error {
+	b.Hash = b.ComputeHash()
+	return nil
+}
+
+// Mine seals n blocks from the mempool right away, empty or not, and returns
+// them. It works whether or not the engine is started.
+func (d *Dev) Mine(n int) ([]core.Block, error) {
+	d.sealMu.Lock()
+	defer d.sealMu.Unlock()
+	var blocks []core.Block
+	for i := 0; i < n; i++ {
+		b, err := d.seal(true)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// seal adds a block of the mempool's transactions to the chain, returning a
+// zero block if none are valid and empty is false. Callers must hold sealMu.
+func (d *Dev) seal(empty bool) (core.Block, error) {
+	block, _ := d.builder.Build(d.Now().Unix())
+	if len(block.Transactions) == 0 && !empty {
+		return core.Block{}, nil
+	}
+	if err := d.Seal(&block); err != nil {
+		return core.Block{}, err
+	}
+	if err := d.chain.AddBlock(block); err != nil {
+		return core.Block{}, err
+	}
+	d.mempool.ClearMined(block.Transactions)
+	fmt.Println("Sealed block", block.Number, block.Hash)
+	return block, nil
+}
+
+// sealPending seals blocks until the mempool has no includable transactions.
+func (d *Dev) sealPending() {
+	d.sealMu.Lock()
+	defer d.sealMu.Unlock()
+	for d.mempool.Len() > 0 {
+		b, err := d.seal(false)
+		if err != nil {
+			log.Println("dev: sealed block rejected:", err)
+			return
+		}
+		if b.Hash == "" {
+			return
+		}
+	}
+}
+
+// Start launches the sealing loop. Calling it on a running engine is a no-op.
+func (d *Dev) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		var tick <-chan time.Time
+		if d.config.Period > 0 {
+			ticker := time.NewTicker(d.config.Period)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		// transactions may have arrived while stopped
+		d.sealPending()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.wake:
+				d.sealPending()
+			case <-tick:
+				if _, err := d.Mine(1); err != nil {
+					log.Println("dev: sealed block rejected:", err)
+				}
+			}
+		}
+	}(d.done)
+	return nil
+}
+
+// Stop halts the sealing loop and waits for it to exit. Calling it on a
+// stopped engine is a no-op.
+func (d *Dev) Stop() error {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel, d.done = nil, nil
+	d.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
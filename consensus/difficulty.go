@@ -0,0 +1,127 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"time"
+
+	"modular-blockchain-framework/core"
+)
+
+var (
+	ErrInvalidTarget    = errors.New("unexpected difficulty target")
+	ErrInsufficientWork = errors.New("hash does not meet target")
+
+	two256 = new(big.Int).Lsh(big.NewInt(1), 256)
+)
+
+// PoWConfig controls difficulty retargeting.
+type PoWConfig struct {
+	// Difficulty is the minimum difficulty in leading zero hex digits; its
+	// target is used for the first blocks and is never exceeded.
+	Difficulty       int
+	TargetBlockTime  time.Duration
+	RetargetInterval uint64 // blocks between adjustments
+	MaxAdjustment    int64  // a retarget changes the target by at most this factor
+	Threads          int    // mining worker goroutines
+	Coinbase         string // credited with the rewards of mined blocks; empty mines for nobody
+	Limits           core.BlockLimits
+}
+
+func DefaultPoWConfig(difficulty int) PoWConfig {
+	return PoWConfig{
+		Difficulty:       difficulty,
+		TargetBlockTime:  5 * time.Second,
+		RetargetInterval: 10,
+		MaxAdjustment:    4,
+		Threads:          runtime.NumCPU(),
+		Limits:           core.DefaultBlockLimits(),
+	}
+}
+
+// DifficultyToTarget converts leading-zero hex digits into the equivalent
+// 256-bit target: 16^(64-diff) - 1.
+func DifficultyToTarget(diff int) *big.Int {
+	if diff < 0 {
+		diff = 0
+	}
+	t := new(big.Int).Rsh(two256, uint(4*diff))
+	return t.Sub(t, big.NewInt(1))
+}
+
+func formatTarget(t *big.Int) string { return fmt.Sprintf("%064x", t) }
+
+func parseTarget(s string) (*big.Int, bool) {
+	if len(s) != 64 {
+		return nil, false
+	}
+	t, ok := new(big.Int).SetString(s, 16)
+	if !ok || t.Sign() <= 0 {
+		return nil, false
+	}
+	return t, true
+}
+
+// meetsTarget reports whether the hex hash, read as a number, is <= target.
+func meetsTarget(hash string, target *big.Int) bool {
+	h, ok := new(big.Int).SetString(hash, 16)
+	return ok && h.Cmp(target) <= 0
+}
+
+// nextTarget computes the target a child of parent must carry. Every
+// RetargetInterval blocks the parent's target is scaled by how long the last
+// interval actually took relative to TargetBlockTime.
+func (p *PoW) nextTarget(chain core.ChainReader, parent core.Block) (*big.Int, error) {
+	limit := DifficultyToTarget(p.config.Difficulty)
+	current, ok := parseTarget(parent.Target)
+	if !ok {
+		// genesis carries no target
+		return limit, nil
+	}
+	number := parent.Number + 1
+	if p.config.RetargetInterval == 0 || number%p.config.RetargetInterval != 0 {
+		return current, nil
+	}
+
+	// measure from block max(1, number-1-interval); genesis timestamps are arbitrary
+	first := parent
+	for first.Number > 1 && parent.Number-first.Number < p.config.RetargetInterval {
+		prev, ok := chain.BlockByHash(first.PrevHash)
+		if !ok {
+			return nil, fmt.Errorf("missing ancestor %s of block %d", first.PrevHash, number)
+		}
+		first = prev
+	}
+	blocks := int64(parent.Number - first.Number)
+	if blocks == 0 {
+		return current, nil
+	}
+	expected := blocks * int64(p.config.TargetBlockTime/time.Second)
+	actual := parent.Timestamp - first.Timestamp
+	if adj := p.config.MaxAdjustment; adj > 0 {
+		if actual < expected/adj {
+			actual = expected / adj
+		}
+		if actual > expected*adj {
+			actual = expected * adj
+		}
+	}
+	if actual < 1 {
+		actual = 1
+	}
+	if expected < 1 {
+		expected = 1
+	}
+
+	next := new(big.Int).Mul(current, big.NewInt(actual))
+	next.Div(next, big.NewInt(expected))
+	if next.Cmp(limit) > 0 {
+		next = limit
+	}
+	if next.Sign() <= 0 {
+		next = big.NewInt(1)
+	}
+	return next, nil
+}
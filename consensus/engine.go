@@ -5,6 +5,6 @@ import "modular-blockchain-framework/core"
 type ConsensusEngine interface {
 	Start() error
 	Stop() error
-	ProposeBlock(txs []core.Transaction) core.Block
-	ValidateBlock(b core.Block) bool
+	ProposeBlock(txs []core.Transaction) (core.Block, error)
+	ValidateBlock(b core.Block) error
 }
\ No newline at end of file
@@ -0,0 +1,92 @@
+package consensus_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"testing"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/consensus/enginetest"
+	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newValidator(t *testing.T) (key *ecdsa.PrivateKey, addr, keyHex string) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, crypto.PubkeyToAddress(key.PublicKey).Hex(), hex.EncodeToString(crypto.FromECDSA(key))
+}
+
+func TestPoWConformance(t *testing.T) {
+	enginetest.Run(t, enginetest.Setup{
+		New: func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error) {
+			return consensus.New("pow", c, m, []byte(`{"difficulty":1,"threads":2,"coinbase":"0x00000000000000000000000000000000000000cb"}`))
+		},
+		Seal: func(e consensus.ConsensusEngine, b *core.Block) error {
+			return e.(*consensus.PoW).Seal(context.Background(), b)
+		},
+	})
+}
+
+func TestPoAConformance(t *testing.T) {
+	_, addr, keyHex := newValidator(t)
+	enginetest.Run(t, enginetest.Setup{
+		New: func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error) {
+			return consensus.New("poa", c, m, []byte(`{"validators":["`+addr+`"],"validatorKey":"`+keyHex+`","period":"1s"}`))
+		},
+		Seal: func(e consensus.ConsensusEngine, b *core.Block) error { return e.(*consensus.PoA).Seal(b) },
+	})
+}
+
+func TestPoSConformance(t *testing.T) {
+	_, addr, keyHex := newValidator(t)
+	g := core.DefaultGenesis()
+	g.Staking = &core.StakingConfig{UnbondingPeriod: 10, SlashPercent: 50, Stakes: map[string]int{addr: 100}}
+	enginetest.Run(t, enginetest.Setup{
+		Genesis: g,
+		New: func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error) {
+			return consensus.New("pos", c, m, []byte(`{"validatorKey":"`+keyHex+`","slotTime":"1s"}`))
+		},
+		Seal: func(e consensus.ConsensusEngine, b *core.Block) error { return e.(*consensus.PoS).Seal(b) },
+	})
+}
+
+func TestDevConformance(t *testing.T) {
+	enginetest.Run(t, enginetest.Setup{
+		New: func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error) {
+			return consensus.New("dev", c, m, nil)
+		},
+		Seal: func(e consensus.ConsensusEngine, b *core.Block) error { return e.(*consensus.Dev).Seal(b) },
+	})
+}
+
+// A single validator is its own quorum, so sealing only needs its precommit
+// as the certificate.
+func TestBFTConformance(t *testing.T) {
+	key, addr, keyHex := newValidator(t)
+	enginetest.Run(t, enginetest.Setup{
+		New: func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error) {
+			return consensus.New("bft", c, m, []byte(`{"validators":["`+addr+`"],"validatorKey":"`+keyHex+`","blockInterval":"100ms"}`))
+		},
+		Seal: func(e consensus.ConsensusEngine, b *core.Block) error {
+			if err := e.(*consensus.BFT).Seal(b); err != nil {
+				return err
+			}
+			vote := consensus.BFTMessage{Type: consensus.MsgPrecommit, Height: b.Number, BlockHash: b.Hash, ValidRound: -1}
+			if err := consensus.SignBFTMessage(&vote, key); err != nil {
+				return err
+			}
+			b.Certificate = &core.CommitCertificate{
+				Height:     b.Number,
+				BlockHash:  b.Hash,
+				Precommits: []core.CommitSig{{Validator: addr, Signature: vote.Signature}},
+			}
+			return nil
+		},
+	})
+}
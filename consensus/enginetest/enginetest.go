@@ -0,0 +1,268 @@
+// Package enginetest is the conformance suite every consensus.ConsensusEngine
+// must pass. An engine's tests call Run with a Setup that knows how to build
+// and seal for it:
+//
+//	func TestConformance(t *testing.T) {
+//		enginetest.Run(t, enginetest.Setup{New: ..., Seal: ...})
+//	}
+package enginetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Setup describes the engine under test.
+type Setup struct {
+	// Genesis is the chain the engine runs on, e.g. with the engine's
+	// validators staked. nil means core.DefaultGenesis. The suite adds a
+	// funded account of its own to a copy.
+	Genesis *core.Genesis
+	// New builds a fresh engine on c and m. It is called once per subtest.
+	New func(c *core.Chain, m *core.Mempool) (consensus.ConsensusEngine, error)
+	// Seal turns a block from ProposeBlock into one the chain accepts.
+	Seal func(e consensus.ConsensusEngine, b *core.Block) error
+}
+
+const (
+	funds       = 1000
+	gasPrice    = 1
+	stopTimeout = 10 * time.Second
+)
+
+type env struct {
+	chain   *core.Chain
+	mempool *core.Mempool
+	engine  consensus.ConsensusEngine
+	sender  string
+	signTx  func(tx *core.Transaction)
+}
+
+// Run runs the conformance suite against the engine described by s.
+func Run(t *testing.T, s Setup) {
+	t.Run("Propose", func(t *testing.T) { testPropose(t, s) })
+	t.Run("Validate", func(t *testing.T) { testValidate(t, s) })
+	t.Run("StartStop", func(t *testing.T) { testStartStop(t, s) })
+	t.Run("RejectTampered", func(t *testing.T) { testRejectTampered(t, s) })
+}
+
+func newEnv(t *testing.T, s Setup) *env {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := crypto.PubkeyToAddress(key.PublicKey).Hex()
+
+	base := s.Genesis
+	if base == nil {
+		base = core.DefaultGenesis()
+	}
+	g := *base
+	g.Alloc = map[string]int{sender: funds}
+	for addr, amount := range base.Alloc {
+		g.Alloc[addr] = amount
+	}
+
+	c := core.NewChainWithGenesis(&g)
+	m := core.NewMempool()
+	engine, err := s.New(c, m)
+	if err != nil {
+		t.Fatalf("new engine: %v", err)
+	}
+	return &env{
+		chain:   c,
+		mempool: m,
+		engine:  engine,
+		sender:  sender,
+		signTx: func(tx *core.Transaction) {
+			sig, err := crypto.Sign(tx.SigningHash(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.Signature = hexutil.Encode(sig)
+		},
+	}
+}
+
+func (e *env) transfer(amount int, nonce uint64) core.Transaction {
+	tx := core.Transaction{
+		From: e.sender, To: "0x742d35Cc6634C0532925a3b844Bc454e4438f44e", Amount: amount, Nonce: nonce,
+		GasLimit: core.GasTransfer, GasPrice: gasPrice, ChainID: e.chain.ChainID(),
+	}
+	e.signTx(&tx)
+	return tx
+}
+
+// sealed proposes a block with one valid transfer and seals it.
+func (e *env) sealed(t *testing.T, s Setup) core.Block {
+	t.Helper()
+	b, err := e.engine.ProposeBlock([]core.Transaction{e.transfer(10, 1)})
+	if err != nil {
+		t.Fatalf("propose: %v", err)
+	}
+	if err := s.Seal(e.engine, &b); err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	return b
+}
+
+func testPropose(t *testing.T, s Setup) {
+	e := newEnv(t, s)
+	head := e.chain.LatestBlock()
+
+	good := e.transfer(10, 1)
+	forged := e.transfer(20, 2)
+	forged.Amount = 500
+	overdraft := e.transfer(funds, 2) // leaves nothing for the fee
+	replay := e.transfer(10, 1)
+	foreign := e.transfer(10, 2)
+	foreign.ChainID++
+	e.signTx(&foreign)
+	b, err := e.engine.ProposeBlock([]core.Transaction{good, forged, overdraft, replay, foreign})
+	if err != nil {
+		t.Fatalf("propose: %v", err)
+	}
+
+	if b.Number != head.Number+1 || b.PrevHash != head.Hash {
+		t.Errorf("proposed block %d on %s, want %d on %s", b.Number, b.PrevHash, head.Number+1, head.Hash)
+	}
+	if b.Timestamp < head.Timestamp {
+		t.Errorf("timestamp %d before parent's %d", b.Timestamp, head.Timestamp)
+	}
+	if len(b.Transactions) != 1 || b.Transactions[0].ID() != good.ID() {
+		t.Fatalf("proposed %d transactions, want only the valid one", len(b.Transactions))
+	}
+	if b.TxRoot != core.MerkleRoot(b.TxIDs()) {
+		t.Errorf("tx root %s does not match the transactions", b.TxRoot)
+	}
+	if e.chain.LatestBlock().Hash != head.Hash {
+		t.Error("proposing changed the chain head")
+	}
+}
+
+func testValidate(t *testing.T, s Setup) {
+	e := newEnv(t, s)
+	b := e.sealed(t, s)
+
+	if err := e.engine.ValidateBlock(b); err != nil {
+		t.Fatalf("sealed block invalid: %v", err)
+	}
+	if err := e.chain.AddBlock(b); err != nil {
+		t.Fatalf("sealed block rejected: %v", err)
+	}
+	if head := e.chain.LatestBlock(); head.Hash != b.Hash {
+		t.Fatalf("head is %s, want %s", head.Hash, b.Hash)
+	}
+	want := funds - 10 - b.Transactions[0].Fee()
+	if got := e.chain.GetBalance(e.sender); got != want {
+		t.Errorf("sender balance %d, want %d", got, want)
+	}
+
+	// the next block builds on the new head
+	next, err := e.engine.ProposeBlock([]core.Transaction{e.transfer(5, 2)})
+	if err != nil {
+		t.Fatalf("propose on new head: %v", err)
+	}
+	if next.PrevHash != b.Hash || len(next.Transactions) != 1 {
+		t.Errorf("next block on %s with %d transactions, want on %s with 1", next.PrevHash, len(next.Transactions), b.Hash)
+	}
+}
+
+func testStartStop(t *testing.T, s Setup) {
+	e := newEnv(t, s)
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"stop before start", e.engine.Stop},
+		{"start", e.engine.Start},
+		{"start again", e.engine.Start},
+		{"stop", e.engine.Stop},
+		{"stop again", e.engine.Stop},
+		{"restart", e.engine.Start},
+		{"stop after restart", e.engine.Stop},
+	}
+	for _, step := range steps {
+		if err := within(stopTimeout, step.fn); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+}
+
+func within(d time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return fmt.Errorf("did not return within %v", d)
+	}
+}
+
+func testRejectTampered(t *testing.T, s Setup) {
+	e := newEnv(t, s)
+	b := e.sealed(t, s)
+	other := e.transfer(10, 1)
+	other.To = "0x742d35Cc6634C0532925a3b844Bc454e4438f44f"
+	e.signTx(&other)
+
+	tampers := []struct {
+		name string
+		fn   func(b *core.Block)
+	}{
+		{"amount", func(b *core.Block) { b.Transactions[0].Amount++ }},
+		{"swapped tx", func(b *core.Block) { b.Transactions[0] = other }},
+		{"dropped tx", func(b *core.Block) { b.Transactions = nil }},
+		{"timestamp", func(b *core.Block) { b.Timestamp++ }},
+		{"state root", func(b *core.Block) { b.StateRoot = core.MerkleRoot([]string{"forged"}) }},
+		{"state root rehashed", func(b *core.Block) {
+			b.StateRoot = core.MerkleRoot([]string{"forged"})
+			b.Hash = b.ComputeHash()
+		}},
+		{"prev hash", func(b *core.Block) {
+			b.PrevHash = core.MerkleRoot([]string{"unknown"})
+			b.Hash = b.ComputeHash()
+		}},
+		{"number", func(b *core.Block) {
+			b.Number++
+			b.Hash = b.ComputeHash()
+		}},
+		{"nonce", func(b *core.Block) { b.Nonce++ }},
+		{"signature", func(b *core.Block) {
+			b.Signature = "0x" + fmt.Sprintf("%0130x", 1)
+			b.Hash = b.ComputeHash()
+		}},
+		{"hash", func(b *core.Block) { b.Hash = core.MerkleRoot([]string{"forged"}) }},
+	}
+	head := e.chain.LatestBlock()
+	for _, tc := range tampers {
+		t.Run(tc.name, func(t *testing.T) {
+			bad := b
+			bad.Transactions = append([]core.Transaction(nil), b.Transactions...)
+			tc.fn(&bad)
+			if err := e.engine.ValidateBlock(bad); err == nil {
+				t.Error("ValidateBlock accepted the tampered block")
+			}
+			if err := e.chain.AddBlock(bad); err == nil {
+				t.Error("AddBlock accepted the tampered block")
+			}
+			if got := e.chain.LatestBlock().Hash; got != head.Hash {
+				t.Errorf("head moved to %s", got)
+			}
+		})
+	}
+
+	// the untampered block still goes in
+	if err := e.chain.AddBlock(b); err != nil {
+		t.Fatalf("original block rejected after tampering copies: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package consensus
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"modular-blockchain-framework/core"
+)
+
+// checkInterval is how many hashes a worker tries between cancellation checks.
+const checkInterval = 1 << 12
+
+// MinerStats reports the miner's hash rate.
+type MinerStats struct {
+	Threads     int     `json:"threads"`
+	Hashes      uint64  `json:"hashes"`      // total hashes tried since start
+	HashRate    float64 `json:"hashRate"`    // hashes per second during the latest seal
+	AvgHashRate float64 `json:"avgHashRate"` // hashes per second over all seals
+	BlocksFound uint64  `json:"blocksFound"`
+	Aborted     uint64  `json:"aborted"` // seals cancelled before finding a nonce
+}
+
+// Miner searches for a nonce meeting a target, splitting the nonce space
+// evenly across worker goroutines.
+type Miner struct {
+	threads int
+	hashes  atomic.Uint64
+
+	mu       sync.Mutex
+	busy     time.Duration // total time spent sealing
+	lastRate float64
+	found    uint64
+	aborted  uint64
+}
+
+func NewMiner(threads int) *Miner {
+	if threads < 1 {
+		threads = 1
+	}
+	return &Miner{threads: threads}
+}
+
+// Seal searches for a nonce whose header hash meets target. It returns
+// ctx.Err() if ctx is cancelled first.
+func (m *Miner) Seal(ctx context.Context, h core.Header, target *big.Int) (uint64, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		nonce uint64
+		hash  string
+	}
+	found := make(chan result, m.threads)
+	prefix := h.SealPrefix()
+	span := math.MaxUint64 / uint64(m.threads)
+	start := time.Now()
+	before := m.hashes.Load()
+
+	var wg sync.WaitGroup
+	for i := 0; i < m.threads; i++ {
+		first := uint64(i)*span + 1
+		last := first + span - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var tried uint64
+			defer func() { m.hashes.Add(tried) }()
+			for nonce := first; nonce <= last; nonce++ {
+				tried++
+				if tried%checkInterval == 0 {
+					m.hashes.Add(tried)
+					tried = 0
+					if ctx.Err() != nil {
+						return
+					}
+				}
+				if hs := core.HashWithNonce(prefix, nonce); meetsTarget(hs, target) {
+					found <- result{nonce, hs}
+					return
+				}
+			}
+		}()
+	}
+
+	var (
+		res result
+		err error
+	)
+	select {
+	case res = <-found:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	cancel()
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	m.mu.Lock()
+	m.busy += elapsed
+	if secs := elapsed.Seconds(); secs > 0 {
+		m.lastRate = float64(m.hashes.Load()-before) / secs
+	}
+	if err != nil {
+		m.aborted++
+	} else {
+		m.found++
+	}
+	m.mu.Unlock()
+	return res.nonce, res.hash, err
+}
+
+func (m *Miner) Stats() MinerStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := MinerStats{
+		Threads:     m.threads,
+		Hashes:      m.hashes.Load(),
+		HashRate:    m.lastRate,
+		BlocksFound: m.found,
+		Aborted:     m.aborted,
+	}
+	if secs := m.busy.Seconds(); secs > 0 {
+		s.AvgHashRate = float64(s.Hashes) / secs
+	}
+	return s
+}
@@ -0,0 +1,483 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"modular-blockchain-framework/core"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrUnauthorizedSigner = errors.New("signer is not a validator")
+	ErrRecentlySigned     = errors.New("signer sealed too recently")
+	ErrInvalidVote        = errors.New("invalid validator vote")
+	ErrInvalidPeriod      = errors.New("block sealed before the period elapsed")
+	ErrUnexpectedSeal     = errors.New("unexpected seal fields")
+)
+
+// snapshotWindow is how many blocks back validator snapshots are cached. An
+// older one is rebuilt by replaying headers when needed.
+const snapshotWindow = 128
+
+// PoAConfig configures the proof-of-authority engine.
+type PoAConfig struct {
+	Validators []string      // initial validator addresses
+	Period     time.Duration // minimum time between blocks
+	Limits     core.BlockLimits
+}
+
+func DefaultPoAConfig(validators []string) PoAConfig {
+	return PoAConfig{Validators: validators, Period: 5 * time.Second, Limits: core.DefaultBlockLimits()}
+}
+
+// PoA seals blocks with a rotating set of validators, Clique style. The
+// validator for height n is validators[n % len] ("in turn"); others may seal
+// out of turn after a short delay, but no validator may seal more than one of
+// any len/2+1 consecutive blocks. Validators add and remove members by
+// voting in the Candidate/Authorize header fields; a change takes effect once
+// more than half the validators agree.
+type PoA struct {
+	chain   *core.Chain
+	mempool *core.Mempool
+	config  PoAConfig
+	builder *core.BlockBuilder
+	key     *ecdsa.PrivateKey // nil on nodes that only validate
+	signer  string
+
+	mu        sync.Mutex
+	snapshots map[string]*Snapshot // by block hash
+	proposals map[string]bool      // votes this node will cast: candidate -> authorize
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// NewPoA creates a PoA engine and installs its seal check on the chain. key
+// may be nil for a node that follows the chain without sealing.
+func NewPoA(c *core.Chain, m *core.Mempool, cfg PoAConfig, key *ecdsa.PrivateKey) *PoA {
+	a := &PoA{
+		chain:     c,
+		mempool:   m,
+		config:    cfg,
+		builder:   core.NewBlockBuilder(c, m, cfg.Limits),
+		key:       key,
+		snapshots: make(map[string]*Snapshot),
+		proposals: make(map[string]bool),
+	}
+	if key != nil {
+		a.signer = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	}
+	c.SetSealVerifier(a)
+	return a
+}
+
+// Snapshot is the validator set and pending votes as of a block.
+type Snapshot struct {
+	Number     uint64                     `json:"number"`
+	Hash       string                     `json:"hash"`
+	Validators []string                   `json:"validators"` // sorted
+	Recents    map[uint64]string          `json:"recents"`    // block number -> signer
+	Votes      map[string]map[string]bool `json:"votes"`      // candidate -> voter -> authorize
+}
+
+func newSnapshot(validators []string, genesis core.Block) *Snapshot {
+	s := &Snapshot{
+		Number:  genesis.Number,
+		Hash:    genesis.Hash,
+		Recents: make(map[uint64]string),
+		Votes:   make(map[string]map[string]bool),
+	}
+	for _, v := range validators {
+		s.Validators = append(s.Validators, core.NormalizeAddress(v))
+	}
+	sort.Strings(s.Validators)
+	return s
+}
+
+func (s *Snapshot) copy() *Snapshot {
+	cp := &Snapshot{
+		Number:     s.Number,
+		Hash:       s.Hash,
+		Validators: append([]string(nil), s.Validators...),
+		Recents:    make(map[uint64]string, len(s.Recents)),
+		Votes:      make(map[string]map[string]bool, len(s.Votes)),
+	}
+	for n, signer := range s.Recents {
+		cp.Recents[n] = signer
+	}
+	for candidate, votes := range s.Votes {
+		cp.Votes[candidate] = make(map[string]bool, len(votes))
+		for voter, auth := range votes {
+			cp.Votes[candidate][voter] = auth
+		}
+	}
+	return cp
+}
+
+func (s *Snapshot) IsValidator(addr string) bool {
+	i := sort.SearchStrings(s.Validators, addr)
+	return i < len(s.Validators) && s.Validators[i] == addr
+}
+
+// InTurn reports whether signer is the designated sealer for block number.
+func (s *Snapshot) InTurn(number uint64, signer string) bool {
+	return len(s.Validators) > 0 && s.Validators[number%uint64(len(s.Validators))] == signer
+}
+
+// turnDistance is how many positions after the in-turn validator signer sits.
+func (s *Snapshot) turnDistance(number uint64, signer string) int {
+	n := len(s.Validators)
+	inTurn := int(number % uint64(n))
+	return (sort.SearchStrings(s.Validators, signer) - inTurn + n) % n
+}
+
+// signLimit is how many consecutive blocks a validator must leave to others.
+func (s *Snapshot) signLimit() uint64 { return uint64(len(s.Validators)/2 + 1) }
+
+// recentlySigned reports whether signer may not seal block number yet.
+func (s *Snapshot) recentlySigned(number uint64, signer string) bool {
+	for seen, recent := range s.Recents {
+		if recent == signer && seen+s.signLimit() > number {
+			return true
+		}
+	}
+	return false
+}
+
+// validVote reports whether a vote changes the validator set if it passes.
+func (s *Snapshot) validVote(candidate string, authorize bool) bool {
+	return s.IsValidator(candidate) != authorize
+}
+
+// apply advances the snapshot by a block already known to be validly sealed by signer.
+func (s *Snapshot) apply(b core.Block, signer string) {
+	s.Number, s.Hash = b.Number, b.Hash
+	for seen := range s.Recents {
+		if seen+s.signLimit() <= b.Number {
+			delete(s.Recents, seen)
+		}
+	}
+	s.Recents[b.Number] = signer
+
+	if b.Candidate == "" {
+		return
+	}
+	candidate := core.NormalizeAddress(b.Candidate)
+	if !s.validVote(candidate, b.Authorize) {
+		return
+	}
+	if s.Votes[candidate] == nil {
+		s.Votes[candidate] = make(map[string]bool)
+	}
+	s.Votes[candidate][signer] = b.Authorize
+	tally := 0
+	for _, auth := range s.Votes[candidate] {
+		if auth == b.Authorize {
+			tally++
+		}
+	}
+	if tally <= len(s.Validators)/2 {
+		return
+	}
+	delete(s.Votes, candidate)
+	if b.Authorize {
+		s.Validators = append(s.Validators, candidate)
+		sort.Strings(s.Validators)
+		return
+	}
+	for i, v := range s.Validators {
+		if v == candidate {
+			s.Validators = append(s.Validators[:i], s.Validators[i+1:]...)
+			break
+		}
+	}
+	for c, votes := range s.Votes {
+		delete(votes, candidate)
+		if len(votes) == 0 {
+			delete(s.Votes, c)
+		}
+	}
+	for seen, recent := range s.Recents {
+		if recent == candidate {
+			delete(s.Recents, seen)
+		}
+	}
+}
+
+// snapshot returns the validator snapshot as of block b, replaying headers
+// back to the nearest cached snapshot or genesis. a.mu is not held while
+// reading the chain, since VerifySeal runs under the chain's lock.
+func (a *PoA) snapshot(chain core.ChainReader, b core.Block) (*Snapshot, error) {
+	var (
+		pending []core.Block
+		base    *Snapshot
+	)
+	for base == nil {
+		a.mu.Lock()
+		base = a.snapshots[b.Hash]
+		a.mu.Unlock()
+		if base != nil {
+			break
+		}
+		if b.Number == 0 {
+			base = newSnapshot(a.config.Validators, b)
+			break
+		}
+		pending = append(pending, b)
+		parent, ok := chain.BlockByHash(b.PrevHash)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", core.ErrUnknownParent, b.PrevHash)
+		}
+		b = parent
+	}
+
+	snap := base
+	for i := len(pending) - 1; i >= 0; i-- {
+		signer, err := core.RecoverAddress(pending[i].SigningHash(), pending[i].Signature)
+		if err != nil {
+			return nil, err
+		}
+		snap = snap.copy()
+		snap.apply(pending[i], signer)
+	}
+	a.mu.Lock()
+	a.snapshots[base.Hash] = base
+	a.snapshots[snap.Hash] = snap
+	for hash, old := range a.snapshots {
+		if old.Number+snapshotWindow < snap.Number {
+			delete(a.snapshots, hash)
+		}
+	}
+	a.mu.Unlock()
+	return snap, nil
+}
+
+// Validators returns the validator set at the chain head.
+func (a *PoA) Validators() ([]string, error) {
+	snap, err := a.snapshot(a.chain, a.chain.LatestBlock())
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), snap.Validators...), nil
+}
+
+// Propose makes this node vote to add (authorize) or remove a validator in
+// the blocks it seals until the change takes effect or is discarded.
+func (a *PoA) Propose(addr string, authorize bool) error {
+	if !common.IsHexAddress(addr) {
+		return fmt.Errorf("%w: bad address %q", ErrInvalidVote, addr)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.proposals[core.NormalizeAddress(addr)] = authorize
+	return nil
+}
+
+// Discard withdraws a proposal made with Propose.
+func (a *PoA) Discard(addr string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.proposals, core.NormalizeAddress(addr))
+}
+
+// VerifySeal checks that b is signed by a validator allowed to seal it and
+// that its vote and timestamp are acceptable.
+func (a *PoA) VerifySeal(chain core.ChainReader, b core.Block) error {
+	if b.Nonce != 0 || b.Target != "" {
+		return ErrUnexpectedSeal
+	}
+	parent, ok := chain.BlockByHash(b.PrevHash)
+	if !ok {
+		return fmt.Errorf("%w: %s", core.ErrUnknownParent, b.PrevHash)
+	}
+	if b.Timestamp < parent.Timestamp+int64(a.config.Period/time.Second) {
+		return fmt.Errorf("%w: %d after parent %d", ErrInvalidPeriod, b.Timestamp, parent.Timestamp)
+	}
+	signer, err := core.RecoverAddress(b.SigningHash(), b.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidSignature, err)
+	}
+	snap, err := a.snapshot(chain, parent)
+	if err != nil {
+		return err
+	}
+	if !snap.IsValidator(signer) {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedSigner, signer)
+	}
+	if snap.recentlySigned(b.Number, signer) {
+		return fmt.Errorf("%w: %s", ErrRecentlySigned, signer)
+	}
+	if b.Candidate != "" {
+		if !common.IsHexAddress(b.Candidate) || !snap.validVote(core.NormalizeAddress(b.Candidate), b.Authorize) {
+			return fmt.Errorf("%w: %s authorize=%v", ErrInvalidVote, b.Candidate, b.Authorize)
+		}
+	} else if b.Authorize {
+		return fmt.Errorf("%w: authorize without candidate", ErrInvalidVote)
+	}
+	return nil
+}
+
+// BlockWork prefers chains sealed in turn: in-turn blocks weigh 2, others 1.
+func (a *PoA) BlockWork(chain core.ChainReader, b core.Block) *big.Int {
+	parent, ok := chain.BlockByHash(b.PrevHash)
+	if !ok {
+		return big.NewInt(1)
+	}
+	snap, err := a.snapshot(chain, parent)
+	if err != nil {
+		return big.NewInt(1)
+	}
+	signer, err := core.RecoverAddress(b.SigningHash(), b.Signature)
+	if err == nil && snap.InTurn(b.Number, signer) {
+		return big.NewInt(2)
+	}
+	return big.NewInt(1)
+}
+
+func (a *PoA) ValidateBlock(b core.Block) error {
+	return a.chain.ValidateBlock(b)
+}
+
+// ProposeBlock builds an unsigned block on the head from txs, carrying one of
+// this node's pending votes. Seal signs it.
+func (a *PoA) ProposeBlock(txs []core.Transaction) (core.Block, error) {
+	parent := a.chain.LatestBlock()
+	snap, err := a.snapshot(a.chain, parent)
+	if err != nil {
+		return core.Block{}, err
+	}
+	block, _ := a.builder.BuildFrom(txs, a.nextTimestamp(parent))
+	a.prepare(&block, snap)
+	return block, nil
+}
+
+func (a *PoA) nextTimestamp(parent core.Block) int64 {
+	ts := parent.Timestamp + int64(a.config.Period/time.Second)
+	if now := time.Now().Unix(); now > ts {
+		ts = now
+	}
+	return ts
+}
+
+// prepare fills in the vote fields from this node's proposals.
+func (a *PoA) prepare(b *core.Block, snap *Snapshot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	candidates := make([]string, 0, len(a.proposals))
+	for c := range a.proposals {
+		candidates = append(candidates, c)
+	}
+	sort.Strings(candidates)
+	for _, c := range candidates {
+		if snap.validVote(c, a.proposals[c]) {
+			b.Candidate, b.Authorize = c, a.proposals[c]
+			return
+		}
+		// already in effect
+		delete(a.proposals, c)
+	}
+}
+
+// Seal signs b with the validator key and sets its hash.
+func (a *PoA) Seal(b *core.Block) error {
+	if a.key == nil {
+		return errors.New("poa: no validator key configured")
+	}
+	sig, err := crypto.Sign(b.SigningHash(), a.key)
+	if err != nil {
+		return err
+	}
+	b.Signature = hexutil.Encode(sig)
+	b.Hash = b.ComputeHash()
+	return nil
+}
+
+// Start launches the sealing loop if a validator key is configured. Calling
+// it on a running engine is a no-op.
+func (a *PoA) Start() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil || a.key == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		for ctx.Err() == nil {
+			wait := a.trySeal()
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+	}(a.done)
+	return nil
+}
+
+// trySeal seals a block on the head if it is this validator's time to, and
+// returns how long to wait before trying again.
+func (a *PoA) trySeal() time.Duration {
+	const retry = 250 * time.Millisecond
+	parent := a.chain.LatestBlock()
+	snap, err := a.snapshot(a.chain, parent)
+	if err != nil {
+		log.Println("poa: snapshot failed:", err)
+		return a.config.Period
+	}
+	number := parent.Number + 1
+	if !snap.IsValidator(a.signer) || snap.recentlySigned(number, a.signer) {
+		return retry
+	}
+	sealAt := time.Unix(parent.Timestamp, 0).Add(a.config.Period)
+	if !snap.InTurn(number, a.signer) {
+		// give the in-turn validator a head start, then stagger the others
+		// by their distance from it so they do not all seal at once
+		sealAt = sealAt.Add(time.Duration(snap.turnDistance(number, a.signer)) * 500 * time.Millisecond)
+	}
+	if wait := time.Until(sealAt); wait > 0 {
+		return min(wait, retry)
+	}
+
+	block, _ := a.builder.Build(a.nextTimestamp(parent))
+	if block.PrevHash != parent.Hash {
+		return 0
+	}
+	a.prepare(&block, snap)
+	if err := a.Seal(&block); err != nil {
+		log.Println("poa: sealing failed:", err)
+		return a.config.Period
+	}
+	if err := a.chain.AddBlock(block); err != nil {
+		log.Println("poa: sealed block rejected:", err)
+		return retry
+	}
+	a.mempool.ClearMined(block.Transactions)
+	fmt.Println("Sealed block", block.Number, block.Hash)
+	return 0
+}
+
+// Stop halts the sealing loop and waits for it to exit. Calling it on a
+// stopped engine is a no-op.
+func (a *PoA) Stop() error {
+	a.mu.Lock()
+	cancel, done := a.cancel, a.done
+	a.cancel, a.done = nil, nil
+	a.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
@@ -0,0 +1,376 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"modular-blockchain-framework/core"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	ErrInvalidSlot   = errors.New("timestamp is not on a slot boundary")
+	ErrWrongProposer = errors.New("signer is not the slot's proposer")
+	ErrNoStake       = errors.New("no stake bonded")
+	ErrNoSlot        = errors.New("staker proposes none of the upcoming slots")
+)
+
+// PoSConfig configures the proof-of-stake engine. Unbonding period and
+// slashing rate are part of the chain's genesis, see core.StakingConfig.
+type PoSConfig struct {
+	SlotTime    time.Duration // whole seconds; one proposer per slot
+	EpochLength uint64        // blocks between refreshes of the stake distribution
+	Limits      core.BlockLimits
+}
+
+func DefaultPoSConfig() PoSConfig {
+	return PoSConfig{SlotTime: 5 * time.Second, EpochLength: 10, Limits: core.DefaultBlockLimits()}
+}
+
+// equivocationWindow is how many blocks back signed headers are remembered
+// to detect double signing.
+const equivocationWindow = 64
+
+// PoS lets one staker propose per slot, picked at random weighted by bonded
+// stake. Slot k after a parent starts at parent.Timestamp + (k+1)*SlotTime;
+// if its proposer stays silent the next slot's proposer takes over. The
+// stake distribution is read at the last block of the previous epoch so it
+// cannot be changed by the blocks it selects proposers for. A staker caught
+// signing two blocks for the same slot is slashed by the next proposer.
+type PoS struct {
+	chain   *core.Chain
+	mempool *core.Mempool
+	config  PoSConfig
+	builder *core.BlockBuilder
+	key     *ecdsa.PrivateKey // nil on nodes that only validate
+	signer  string
+
+	mu       sync.Mutex
+	seen     map[string]core.Header // signed headers by parent hash and timestamp
+	evidence map[string]core.Evidence
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewPoS creates a PoS engine and installs its seal check on the chain. key
+// may be nil for a node that follows the chain without proposing.
+func NewPoS(c *core.Chain, m *core.Mempool, cfg PoSConfig, key *ecdsa.PrivateKey) *PoS {
+	if cfg.EpochLength == 0 {
+		cfg.EpochLength = 1
+	}
+	p := &PoS{
+		chain:    c,
+		mempool:  m,
+		config:   cfg,
+		builder:  core.NewBlockBuilder(c, m, cfg.Limits),
+		key:      key,
+		seen:     make(map[string]core.Header),
+		evidence: make(map[string]core.Evidence),
+	}
+	if key != nil {
+		p.signer = crypto.PubkeyToAddress(key.PublicKey).Hex()
+	}
+	c.SetSealVerifier(p)
+	c.Subscribe(p.onChainEvent)
+	return p
+}
+
+func (p *PoS) slotSeconds() int64 {
+	if s := int64(p.config.SlotTime / time.Second); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// slot returns which slot after parent a block timestamp falls in.
+func (p *PoS) slot(parent core.Block, timestamp int64) (uint64, error) {
+	delta, t := timestamp-parent.Timestamp, p.slotSeconds()
+	if delta < t || delta%t != 0 {
+		return 0, fmt.Errorf("%w: %d after parent %d", ErrInvalidSlot, timestamp, parent.Timestamp)
+	}
+	return uint64(delta/t - 1), nil
+}
+
+// Proposer returns the staker entitled to seal the given slot after parent.
+func (p *PoS) Proposer(chain core.ChainReader, parent core.Block, slot uint64) (string, error) {
+	anchor := parent
+	for height := (parent.Number / p.config.EpochLength) * p.config.EpochLength; anchor.Number > height; {
+		prev, ok := chain.BlockByHash(anchor.PrevHash)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", core.ErrUnknownParent, anchor.PrevHash)
+		}
+		anchor = prev
+	}
+	// a side branch that starts an epoch of its own can only be checked once
+	// the chain has applied it up to the anchor
+	ledger, ok := chain.StakingAt(anchor.Hash)
+	if !ok {
+		return "", fmt.Errorf("%w: epoch anchor %d %s", core.ErrUnknownState, anchor.Number, anchor.Hash)
+	}
+	stakers := make([]string, 0, len(ledger.Stakes))
+	for addr := range ledger.Stakes {
+		stakers = append(stakers, addr)
+	}
+	sort.Strings(stakers)
+	total := ledger.TotalStake()
+	if total <= 0 {
+		return "", ErrNoStake
+	}
+
+	var seed [8]byte
+	binary.BigEndian.PutUint64(seed[:], slot)
+	h := sha256.Sum256(append([]byte(parent.Hash), seed[:]...))
+	pick := new(big.Int).Mod(new(big.Int).SetBytes(h[:]), big.NewInt(int64(total))).Int64()
+	for _, addr := range stakers {
+		if pick -= int64(ledger.Stakes[addr]); pick < 0 {
+			return addr, nil
+		}
+	}
+	return stakers[len(stakers)-1], nil
+}
+
+// VerifySeal checks that b sits on a slot boundary and is signed by that
+// slot's proposer. Validly signed conflicting headers become evidence.
+func (p *PoS) VerifySeal(chain core.ChainReader, b core.Block) error {
+	if b.Nonce != 0 || b.Target != "" || b.Candidate != "" || b.Authorize {
+		return ErrUnexpectedSeal
+	}
+	parent, ok := chain.BlockByHash(b.PrevHash)
+	if !ok {
+		return fmt.Errorf("%w: %s", core.ErrUnknownParent, b.PrevHash)
+	}
+	slot, err := p.slot(parent, b.Timestamp)
+	if err != nil {
+		return err
+	}
+	signer, err := core.RecoverAddress(b.SigningHash(), b.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", core.ErrInvalidSignature, err)
+	}
+	proposer, err := p.Proposer(chain, parent, slot)
+	if err != nil {
+		return err
+	}
+	if signer != proposer {
+		return fmt.Errorf("%w: %s signed slot %d of %s", ErrWrongProposer, signer, slot, proposer)
+	}
+	p.recordHeader(b.Header)
+	return nil
+}
+
+// recordHeader remembers a validly sealed header and turns a second, different
+// header for the same slot into evidence.
+func (p *PoS) recordHeader(h core.Header) {
+	key := fmt.Sprintf("%s/%d", h.PrevHash, h.Timestamp)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev, ok := p.seen[key]
+	if !ok {
+		p.seen[key] = h
+		for k, old := range p.seen {
+			if old.Number+equivocationWindow < h.Number {
+				delete(p.seen, k)
+			}
+		}
+		return
+	}
+	ev := core.Evidence{A: prev, B: h}
+	if _, err := ev.Offender(); err != nil {
+		return
+	}
+	if _, ok := p.evidence[ev.ID()]; !ok {
+		log.Printf("pos: double signing detected at block %d", h.Number)
+		p.evidence[ev.ID()] = ev
+	}
+}
+
+// SubmitEvidence queues double-sign evidence learned elsewhere for inclusion
+// in the next block this node proposes.
+func (p *PoS) SubmitEvidence(ev core.Evidence) error {
+	if _, err := ev.Offender(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evidence[ev.ID()] = ev
+	return nil
+}
+
+// PendingEvidence returns the evidence waiting to be included.
+func (p *PoS) PendingEvidence() []core.Evidence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]core.Evidence, 0, len(p.evidence))
+	for _, ev := range p.evidence {
+		out = append(out, ev)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID() < out[j].ID() })
+	return out
+}
+
+// onChainEvent forgets evidence once it is in the canonical chain.
+func (p *PoS) onChainEvent(ev core.ChainEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, b := range ev.Added {
+		for i := range b.Evidence {
+			delete(p.evidence, b.Evidence[i].ID())
+		}
+	}
+}
+
+func (p *PoS) ValidateBlock(b core.Block) error {
+	return p.chain.ValidateBlock(b)
+}
+
+// ProposeBlock builds an unsigned block from txs for the first slot after
+// the head that has not started yet and that the staker proposes. Seal signs it.
+func (p *PoS) ProposeBlock(txs []core.Transaction) (core.Block, error) {
+	parent := p.chain.LatestBlock()
+	ts, err := p.ownSlotTime(parent)
+	if err != nil {
+		return core.Block{}, err
+	}
+	block, _ := p.builder.BuildFrom(txs, ts)
+	return block, nil
+}
+
+// ownSlotTime returns the start of the first slot after parent that is not in
+// the past and whose proposer is the staker, looking no further ahead than a
+// block may be dated.
+func (p *PoS) ownSlotTime(parent core.Block) (int64, error) {
+	if p.key == nil {
+		return 0, errors.New("pos: no staker key configured")
+	}
+	limit := time.Now().Add(core.MaxFutureBlockTime).Unix()
+	for ts := p.nextSlotTime(parent); ts <= limit; ts += p.slotSeconds() {
+		slot, err := p.slot(parent, ts)
+		if err != nil {
+			return 0, err
+		}
+		proposer, err := p.Proposer(p.chain, parent, slot)
+		if err != nil {
+			return 0, err
+		}
+		if proposer == p.signer {
+			return ts, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s within %v", ErrNoSlot, p.signer, core.MaxFutureBlockTime)
+}
+
+// nextSlotTime returns the start of the earliest slot after parent that is
+// not in the past.
+func (p *PoS) nextSlotTime(parent core.Block) int64 {
+	t := p.slotSeconds()
+	ts := parent.Timestamp + t
+	if now := time.Now().Unix(); now > ts {
+		ts += (now - ts + t - 1) / t * t
+	}
+	return ts
+}
+
+// Seal signs b with the staker key and sets its hash.
+func (p *PoS) Seal(b *core.Block) error {
+	if p.key == nil {
+		return errors.New("pos: no staker key configured")
+	}
+	sig, err := crypto.Sign(b.SigningHash(), p.key)
+	if err != nil {
+		return err
+	}
+	b.Signature = hexutil.Encode(sig)
+	b.Hash = b.ComputeHash()
+	return nil
+}
+
+// Start launches the proposing loop if a staker key is configured. Calling it
+// on a running engine is a no-op.
+func (p *PoS) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil || p.key == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		for ctx.Err() == nil {
+			wait := p.tryPropose()
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+	}(p.done)
+	return nil
+}
+
+// tryPropose seals a block for the current slot if this node is its proposer,
+// and returns how long to wait before trying again.
+func (p *PoS) tryPropose() time.Duration {
+	const retry = 250 * time.Millisecond
+	parent := p.chain.LatestBlock()
+	ts := time.Now().Unix()
+	t := p.slotSeconds()
+	if ts < parent.Timestamp+t {
+		return min(time.Until(time.Unix(parent.Timestamp+t, 0)), retry)
+	}
+	ts -= (ts - parent.Timestamp) % t
+	slot, err := p.slot(parent, ts)
+	if err != nil {
+		return retry
+	}
+	nextSlot := time.Until(time.Unix(ts+t, 0))
+	proposer, err := p.Proposer(p.chain, parent, slot)
+	if err != nil {
+		log.Println("pos: cannot select proposer:", err)
+		return nextSlot
+	}
+	if proposer != p.signer {
+		return min(nextSlot, retry)
+	}
+
+	block, _ := p.builder.BuildWithEvidence(ts, p.PendingEvidence())
+	if block.PrevHash != parent.Hash || block.Timestamp != ts {
+		return 0
+	}
+	if err := p.Seal(&block); err != nil {
+		log.Println("pos: sealing failed:", err)
+		return nextSlot
+	}
+	if err := p.chain.AddBlock(block); err != nil {
+		log.Println("pos: proposed block rejected:", err)
+		return nextSlot
+	}
+	p.mempool.ClearMined(block.Transactions)
+	fmt.Println("Proposed block", block.Number, block.Hash)
+	return 0
+}
+
+// Stop halts the proposing loop and waits for it to exit. Calling it on a
+// stopped engine is a no-op.
+func (p *PoS) Stop() error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
@@ -1,90 +1,221 @@
 package consensus
 
 import (
-	"crypto/sha256"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"modular-blockchain-framework/core"
-	"modular-blockchain-framework/db"
-	"strings"
+	"sync"
 	"time"
 )
 
 type PoW struct {
-	chain      *core.Chain
-	mempool    *core.Mempool
-	difficulty int // small number for dev, e.g., 2
-	running    bool
+	chain   *core.Chain
+	mempool *core.Mempool
+	config  PoWConfig
+	miner   *Miner
+	builder *core.BlockBuilder
+
+	mu          sync.Mutex
+	cancel      context.CancelFunc // stops the mining loop; nil when stopped
+	done        chan struct{}
+	roundParent string             // parent hash of the block being sealed
+	cancelRound context.CancelFunc // aborts the current seal
 }
 
+// NewPoW creates a PoW engine with the default retargeting schedule and diff
+// as the minimum difficulty (small number for dev, e.g., 2).
 func NewPoW(c *core.Chain, m *core.Mempool, diff int) *PoW {
-	return &PoW{chain: c, mempool: m, difficulty: diff}
+	return NewPoWWithConfig(c, m, DefaultPoWConfig(diff))
 }
 
+// NewPoWWithConfig creates a PoW engine and installs its seal check on the chain.
+func NewPoWWithConfig(c *core.Chain, m *core.Mempool, cfg PoWConfig) *PoW {
+	p := &PoW{
+		chain:   c,
+		mempool: m,
+		config:  cfg,
+		miner:   NewMiner(cfg.Threads),
+		builder: core.NewBlockBuilder(c, m, cfg.Limits),
+	}
+	p.builder.SetCoinbase(cfg.Coinbase)
+	c.SetSealVerifier(p)
+	c.Subscribe(p.onChainEvent)
+	return p
+}
+
+// Start launches the mining loop. Calling it on a running engine is a no-op.
 func (p *PoW) Start() error {
-	p.running = true
-	go func() {
-		for p.running {
-			if !p.mine() {
-				time.Sleep(time.Second)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		for ctx.Err() == nil {
+			if !p.mine(ctx) {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
 			}
 		}
-	}()
+	}(p.done)
 	return nil
 }
 
-func (p *PoW) mine() bool {
-	txs := p.mempool.PendingTransactions()
-	if len(txs) == 0 {
+// onChainEvent abandons the current seal when the head moves off its parent.
+func (p *PoW) onChainEvent(ev core.ChainEvent) {
+	head := ev.Added[len(ev.Added)-1]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancelRound != nil && head.Hash != p.roundParent {
+		p.cancelRound()
+	}
+}
+
+// MinerStats reports hash rate statistics for the mining workers.
+func (p *PoW) MinerStats() MinerStats { return p.miner.Stats() }
+
+func (p *PoW) mine(ctx context.Context) bool {
+	if p.mempool.Len() == 0 {
 		return false
 	}
-	last := p.chain.LatestBlock()
-	timestamp := time.Now().Unix()
-	for i := range txs {
-		if txs[i].Timestamp == 0 {
-			txs[i].Timestamp = timestamp
-		}
+	block, _ := p.builder.Build(time.Now().Unix())
+	if len(block.Transactions) == 0 {
+		return false
+	}
+	target, err := p.prepare(&block)
+	if err != nil {
+		log.Println("cannot compute target:", err)
+		return false
+	}
+	parentHash := block.PrevHash
+
+	roundCtx, cancelRound := context.WithCancel(ctx)
+	defer cancelRound()
+	p.mu.Lock()
+	p.roundParent, p.cancelRound = parentHash, cancelRound
+	p.mu.Unlock()
+	if p.chain.LatestBlock().Hash != parentHash {
+		// the head moved before the round was registered
+		return true
 	}
-	block := core.Block{
-		Number:       last.Number + 1,
-		PrevHash:     last.Hash,
-		Timestamp:    timestamp,
-		Transactions: txs,
+	nonce, hash, err := p.miner.Seal(roundCtx, block.Header, target)
+	p.mu.Lock()
+	p.cancelRound = nil
+	p.mu.Unlock()
+	if errors.Is(err, context.Canceled) {
+		if ctx.Err() == nil {
+			log.Println("new head arrived, abandoning block", block.Number)
+		}
+		return true
 	}
-	nonce, hash := mineBlock(block, p.difficulty)
 	block.Nonce = nonce
 	block.Hash = hash
-	p.chain.AddBlock(block)
-	if err := db.InsertBlock(&block); err != nil {
-		log.Println("warning: failed to persist block:", err)
+	if err := p.chain.AddBlock(block); err != nil {
+		log.Println("mined block rejected:", err)
+		return false
 	}
-	p.mempool.Clear()
+	p.mempool.ClearMined(block.Transactions)
 	fmt.Println("Mined block", block.Number, hash)
 	return true
 }
 
-func (p *PoW) Stop() error { p.running = false; return nil }
+// Stop aborts any seal in progress and waits for the mining loop to exit.
+// Calling it on a stopped engine is a no-op.
+func (p *PoW) Stop() error {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
 
-func (p *PoW) ProposeBlock(txs []core.Transaction) core.Block {
-	// create block; real miner would include txs
-	return core.Block{}
+// ProposeBlock builds an unsealed block on the current head from txs, with
+// the target it must be mined to. Invalid transactions are left out.
+func (p *PoW) ProposeBlock(txs []core.Transaction) (core.Block, error) {
+	block, _ := p.builder.BuildFrom(txs, time.Now().Unix())
+	if _, err := p.prepare(&block); err != nil {
+		return core.Block{}, err
+	}
+	return block, nil
 }
 
-func (p *PoW) ValidateBlock(b core.Block) bool {
-	// check hash difficulty
-	h := sha256.Sum256([]byte(fmt.Sprintf("%d%s%d%d", b.Number, b.PrevHash, b.Nonce, b.Timestamp)))
-	hs := fmt.Sprintf("%x", h)
-	return hs[:p.difficulty] == strings.Repeat("0", p.difficulty)
+// Seal mines b to the target in its header and sets its nonce and hash.
+func (p *PoW) Seal(ctx context.Context, b *core.Block) error {
+	target, ok := parseTarget(b.Target)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidTarget, b.Target)
+	}
+	nonce, hash, err := p.miner.Seal(ctx, b.Header, target)
+	if err != nil {
+		return err
+	}
+	b.Nonce, b.Hash = nonce, hash
+	return nil
 }
 
-func mineBlock(b core.Block, diff int) (uint64, string) {
-	var nonce uint64
-	for {
-		nonce++
-		h := sha256.Sum256([]byte(fmt.Sprintf("%d%s%d%d", b.Number, b.PrevHash, nonce, b.Timestamp)))
-		hs := fmt.Sprintf("%x", h)
-		if hs[:diff] == strings.Repeat("0", diff) {
-			return nonce, hs
-		}
+// prepare fills in the PoW header fields of an unsealed block.
+func (p *PoW) prepare(b *core.Block) (*big.Int, error) {
+	parent, ok := p.chain.BlockByHash(b.PrevHash)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", core.ErrUnknownParent, b.PrevHash)
+	}
+	target, err := p.nextTarget(p.chain, parent)
+	if err != nil {
+		return nil, err
+	}
+	b.Target = formatTarget(target)
+	return target, nil
+}
+
+// ValidateBlock runs the chain's header, body and state checks, which include
+// the PoW seal via VerifySeal.
+func (p *PoW) ValidateBlock(b core.Block) error {
+	return p.chain.ValidateBlock(b)
+}
+
+// VerifySeal checks that the block carries the target the retargeting
+// schedule expects and that its hash meets it.
+func (p *PoW) VerifySeal(chain core.ChainReader, b core.Block) error {
+	if b.Signature != "" || b.Candidate != "" || b.Authorize {
+		return ErrUnexpectedSeal
+	}
+	parent, ok := chain.BlockByHash(b.PrevHash)
+	if !ok {
+		return fmt.Errorf("%w: %s", core.ErrUnknownParent, b.PrevHash)
+	}
+	want, err := p.nextTarget(chain, parent)
+	if err != nil {
+		return err
+	}
+	if b.Target != formatTarget(want) {
+		return fmt.Errorf("%w: have %s, want %s", ErrInvalidTarget, b.Target, formatTarget(want))
+	}
+	if !meetsTarget(b.Hash, want) {
+		return fmt.Errorf("%w: %s above %s", ErrInsufficientWork, b.Hash, b.Target)
+	}
+	return nil
+}
+
+// BlockWork weighs a block by the expected number of hashes needed to seal
+// it, 2^256 / (target+1).
+func (p *PoW) BlockWork(chain core.ChainReader, b core.Block) *big.Int {
+	target, ok := parseTarget(b.Target)
+	if !ok {
+		return new(big.Int)
 	}
+	return new(big.Int).Div(two256, new(big.Int).Add(target, big.NewInt(1)))
 }
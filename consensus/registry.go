@@ -0,0 +1,168 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"modular-blockchain-framework/core"
+)
+
+var ErrUnknownEngine = errors.New("unknown consensus engine")
+
+// Registration describes a consensus engine that nodes can select by name.
+type Registration struct {
+	Name        string
+	Description string
+	// Config returns the engine's default options: a pointer to a struct
+	// whose JSON-tagged fields are the config schema.
+	Config func() any
+	// New builds the engine from options of the type Config returns.
+	New func(c *core.Chain, m *core.Mempool, config any) (ConsensusEngine, error)
+}
+
+// ConfigField describes one option of an engine's config.
+type ConfigField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     any    `json:"default"`
+	Description string `json:"description,omitempty"`
+}
+
+var registry = struct {
+	sync.RWMutex
+	engines map[string]Registration
+}{engines: make(map[string]Registration)}
+
+// Register makes an engine available to New. It panics if the name is taken
+// or the registration is incomplete, since both are programming errors.
+func Register(r Registration) {
+	if r.Name == "" || r.Config == nil || r.New == nil {
+		panic("consensus: incomplete registration for " + r.Name)
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, dup := registry.engines[r.Name]; dup {
+		panic("consensus: engine " + r.Name + " registered twice")
+	}
+	registry.engines[r.Name] = r
+}
+
+// Engines returns the registered engine names in order.
+func Engines() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.engines))
+	for name := range registry.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Registration, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	r, ok := registry.engines[name]
+	if !ok {
+		return Registration{}, fmt.Errorf("%w %q (have %s)", ErrUnknownEngine, name, strings.Join(namesLocked(), ", "))
+	}
+	return r, nil
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(registry.engines))
+	for name := range registry.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns an engine's description and config schema.
+func Describe(name string) (string, []ConfigField, error) {
+	r, err := lookup(name)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.Description, schemaOf(r.Config()), nil
+}
+
+// New builds the named engine. config is a JSON object of options; fields it
+// omits keep their defaults and unknown fields are an error.
+func New(name string, c *core.Chain, m *core.Mempool, config json.RawMessage) (ConsensusEngine, error) {
+	r, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	opts := r.Config()
+	if len(bytes.TrimSpace(config)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(config))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(opts); err != nil {
+			return nil, fmt.Errorf("%s config: %w", name, err)
+		}
+	}
+	return r.New(c, m, opts)
+}
+
+func schemaOf(opts any) []ConfigField {
+	v := reflect.ValueOf(opts)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	t := v.Type()
+	var fields []ConfigField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, ConfigField{
+			Name:        name,
+			Type:        typeName(f.Type),
+			Default:     v.Field(i).Interface(),
+			Description: f.Tag.Get("desc"),
+		})
+	}
+	return fields
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(Duration(0)):
+		return "duration"
+	case t.Kind() == reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return "integer"
+	}
+	return t.Kind().String()
+}
+
+// Duration is a time.Duration that reads and writes JSON as a string like "5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
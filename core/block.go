@@ -4,14 +4,40 @@ import (
 	"fmt"
 	"time"
 )
+
 func NewBlock() {
-    fmt.Println("Block created at:", time.Now())
+	fmt.Println("Block created at:", time.Now())
 }
+
 type Block struct {
-	Number       uint64
-	PrevHash     string
-	Timestamp    int64
+	Header
 	Transactions []Transaction
-	Nonce        uint64
+	Evidence     []Evidence // double-sign proofs to slash for
 	Hash         string
-}
\ No newline at end of file
+	Certificate  *CommitCertificate // BFT finality proof; not covered by Hash
+}
+
+// CommitCertificate proves that more than two thirds of a BFT validator set
+// precommitted a block. It is attached after the block is sealed, so it is
+// not part of the header.
+type CommitCertificate struct {
+	Height     uint64      `json:"height"`
+	Round      int         `json:"round"`
+	BlockHash  string      `json:"blockHash"`
+	Precommits []CommitSig `json:"precommits"`
+}
+
+// CommitSig is one validator's precommit signature.
+type CommitSig struct {
+	Validator string `json:"validator"`
+	Signature string `json:"signature"`
+}
+
+// TxIDs returns the IDs of the block's transactions in order.
+func (b *Block) TxIDs() []string {
+	ids := make([]string, len(b.Transactions))
+	for i := range b.Transactions {
+		ids[i] = b.Transactions[i].ID()
+	}
+	return ids
+}
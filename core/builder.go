@@ -0,0 +1,156 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+)
+
+// BlockLimits bounds the contents of a built block. Zero means unlimited.
+type BlockLimits struct {
+	MaxTxs   int
+	MaxBytes int // sum of the JSON-encoded transaction sizes
+}
+
+func DefaultBlockLimits() BlockLimits {
+	return BlockLimits{MaxTxs: 500, MaxBytes: 1 << 20}
+}
+
+// RejectedTx is a candidate transaction the builder left out and why.
+type RejectedTx struct {
+	Tx  Transaction
+	Err error
+}
+
+// Size is the transaction's JSON-encoded length, as served over RPC.
+func (tx *Transaction) Size() int {
+	data, _ := json.Marshal(tx)
+	return len(data)
+}
+
+// BlockBuilder assembles unsealed blocks on top of the chain head. It is
+// engine-agnostic: engines fill in their own seal fields afterwards.
+type BlockBuilder struct {
+	chain    *Chain
+	mempool  *Mempool
+	limits   BlockLimits
+	coinbase string
+}
+
+func NewBlockBuilder(c *Chain, m *Mempool, limits BlockLimits) *BlockBuilder {
+	return &BlockBuilder{chain: c, mempool: m, limits: limits}
+}
+
+// SetCoinbase sets the address credited with the reward of built blocks.
+func (bb *BlockBuilder) SetCoinbase(addr string) {
+	bb.coinbase = addr
+}
+
+// Build assembles a block from the mempool's pending transactions.
+// Transactions that can never become valid are removed from the mempool; the
+// others left out, e.g. for want of funds, stay for Mempool.Revalidate.
+func (bb *BlockBuilder) Build(timestamp int64) (Block, []RejectedTx) {
+	return bb.BuildWithEvidence(timestamp, nil)
+}
+
+// BuildWithEvidence is Build for engines that slash: the block also carries
+// whichever of evidence still applies against the head state.
+func (bb *BlockBuilder) BuildWithEvidence(timestamp int64, evidence []Evidence) (Block, []RejectedTx) {
+	block, rejected := bb.build(bb.mempool.PendingTransactions(), evidence, timestamp)
+	var dropped []Transaction
+	for i := range rejected {
+		if permanentTxError(rejected[i].Err) {
+			log.Printf("dropping tx %s: %v", rejected[i].Tx.ID(), rejected[i].Err)
+			dropped = append(dropped, rejected[i].Tx)
+		}
+	}
+	bb.mempool.ClearMined(dropped)
+	return block, rejected
+}
+
+// permanentTxError reports whether err rejects a transaction whatever state
+// the chain reaches: it is malformed, badly signed, for another chain or
+// type, underpriced, or its nonce is used.
+func permanentTxError(err error) bool {
+	for _, target := range []error{
+		ErrWrongChainID, ErrUnknownTxType, ErrMissingSignature, ErrInvalidSignature, ErrInvalidAmount,
+		ErrIntrinsicGas, ErrInvalidGasPrice, ErrGasPriceTooLow, ErrInvalidNonce,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildFrom assembles a block from candidates in order, skipping any that fail
+// validation against the head state. Candidates beyond the block limits are
+// neither included nor rejected.
+func (bb *BlockBuilder) BuildFrom(candidates []Transaction, timestamp int64) (Block, []RejectedTx) {
+	return bb.build(candidates, nil, timestamp)
+}
+
+func (bb *BlockBuilder) build(candidates []Transaction, evidence []Evidence, timestamp int64) (Block, []RejectedTx) {
+	c := bb.chain
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	parent := c.head.block
+	if timestamp < parent.Timestamp {
+		timestamp = parent.Timestamp
+	}
+	st := c.newStateTransition()
+	overlay := st.overlay
+	var included []Evidence
+	for i := range evidence {
+		if err := overlay.applyEvidence(&evidence[i]); err == nil {
+			included = append(included, evidence[i])
+		}
+	}
+	header := Header{
+		Number:    parent.Number + 1,
+		PrevHash:  parent.Hash,
+		Timestamp: timestamp,
+		Coinbase:  bb.coinbase,
+	}
+	// a failing hook makes the block invalid whatever it holds; build it
+	// anyway so the engine sees the failure when it validates
+	if err := overlay.beginBlock(&header); err != nil {
+		log.Printf("warning: building block %d: %v", header.Number, err)
+	}
+	var (
+		txs      []Transaction
+		rejected []RejectedTx
+		size     int
+		gas      uint64
+	)
+	gasLimit := c.gasConfig().BlockGasLimit
+	for _, tx := range candidates {
+		if bb.limits.MaxTxs > 0 && len(txs) >= bb.limits.MaxTxs {
+			break
+		}
+		txSize := tx.Size()
+		if bb.limits.MaxBytes > 0 && size+txSize > bb.limits.MaxBytes {
+			continue
+		}
+		if gasLimit > 0 && gas+tx.Gas() > gasLimit {
+			continue
+		}
+		if err := st.apply(&tx); err != nil {
+			rejected = append(rejected, RejectedTx{Tx: tx, Err: err})
+			continue
+		}
+		txs = append(txs, tx)
+		size += txSize
+		gas += tx.Gas()
+	}
+	if err := overlay.endBlock(&header); err != nil {
+		log.Printf("warning: building block %d: %v", header.Number, err)
+	}
+	overlay.reward(bb.coinbase)
+	header.StateRoot = overlay.root()
+	block := Block{Header: header, Transactions: txs, Evidence: included}
+	block.TxRoot = MerkleRoot(block.TxIDs())
+	block.EvidenceRoot = MerkleRoot(block.EvidenceIDs())
+	return block, rejected
+}
@@ -1,42 +1,151 @@
 package core
 
 import (
+	"fmt"
+	"log"
+	"math/big"
 	"sync"
 )
 
 type Chain struct {
-	mu     sync.RWMutex
-	Blocks []Block
-	State  map[string]int    // simple state: balances
-	Nonces map[string]uint64 // per-account nonces to prevent replay
+	mu           sync.RWMutex
+	genesis      *Genesis
+	sealVerifier SealVerifier
+	router       TxRouter              // NativeRouter if nil
+	nodes        map[string]*blockNode // every known block by hash
+	head         *blockNode
+	subscribers  []func(ChainEvent)
+	eventMu      sync.Mutex        // delivers events in the order they happened
+	Blocks       []Block           // canonical chain, genesis first
+	State        map[string]int    // simple state: balances
+	Nonces       map[string]uint64 // per-account nonces to prevent replay
+	kv           map[string][]byte // module stores, keyed by namespace/key
+	trie         *trieNode         // commits to the above and the head's staking ledger
 }
 
 func NewChain() *Chain {
+	return NewChainWithGenesis(DefaultGenesis())
+}
+
+func NewChainWithGenesis(g *Genesis) *Chain {
 	c := &Chain{
-		State:  make(map[string]int),
-		Nonces: make(map[string]uint64),
+		genesis: g,
+		State:   make(map[string]int),
+		Nonces:  make(map[string]uint64),
+		kv:      make(map[string][]byte),
 	}
 	c.CreateGenesisIfNotExists()
 	return c
 }
 
-func (c *Chain) AddBlock(b Block) {
+// SetSealVerifier installs the consensus engine's seal check into block validation.
+func (c *Chain) SetSealVerifier(v SealVerifier) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.State == nil {
-		c.State = make(map[string]int)
+	c.sealVerifier = v
+}
+
+// Subscribe registers fn to be called after every change of the canonical
+// chain. fn runs without the chain lock held but must not add blocks itself.
+func (c *Chain) Subscribe(fn func(ChainEvent)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribers = append(c.subscribers, fn)
+}
+
+// ValidateBlock checks b against its parent without adding it. State checks
+// only run when the parent is the current head.
+func (c *Chain) ValidateBlock(b Block) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.validateBlock(b, c.sealVerifier)
+}
+
+// ValidateBlockWithSeal is ValidateBlock with seal checking b's seal in place
+// of the installed verifier, for engines that vote on blocks before they are
+// fully sealed.
+func (c *Chain) ValidateBlockWithSeal(b Block, seal SealVerifier) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.validateBlock(b, seal)
+}
+
+func (c *Chain) validateBlock(b Block, seal SealVerifier) error {
+	parent, err := c.validateStateless(&b, seal)
+	if err != nil {
+		return err
 	}
-	if c.Nonces == nil {
-		c.Nonces = make(map[string]uint64)
+	if parent == c.head {
+		_, err = c.validateState(&b)
 	}
-	c.Blocks = append(c.Blocks, b)
-	for _, tx := range b.Transactions {
-		c.State[tx.From] -= tx.Amount
-		c.State[tx.To] += tx.Amount
-		if tx.Nonce > c.Nonces[tx.From] {
-			c.Nonces[tx.From] = tx.Nonce
-		}
+	return err
+}
+
+// AddBlock validates b and inserts it into the block tree. If b's branch
+// carries the most work it becomes canonical, reorganizing the chain when b
+// does not extend the current head. Rejections are returned as *BlockError.
+func (c *Chain) AddBlock(b Block) error {
+	ev, subscribers, err := c.addBlock(b)
+	if err != nil || len(ev.Added) == 0 {
+		return err
+	}
+	defer c.eventMu.Unlock()
+	for _, fn := range subscribers {
+		fn(ev)
+	}
+	return nil
+}
+
+// addBlock is AddBlock's locked part. If the canonical chain changed it
+// returns with c.eventMu held, taken before c.mu is released so events are
+// delivered in order.
+func (c *Chain) addBlock(b Block) (ChainEvent, []func(ChainEvent), error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.nodes[b.Hash]; ok {
+		return ChainEvent{}, nil, rejectBlock(&b, StageHeader, ErrKnownBlock)
+	}
+	parent, err := c.validateStateless(&b, c.sealVerifier)
+	if err != nil {
+		return ChainEvent{}, nil, err
 	}
+	ev, err := c.insertBlock(parent, b)
+	if err != nil || len(ev.Added) == 0 {
+		return ev, nil, err
+	}
+	c.eventMu.Lock()
+	return ev, c.subscribers, nil
+}
+
+// HasBlock reports whether a block with the given hash is in the block tree.
+func (c *Chain) HasBlock(hash string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.nodes[hash]
+	return ok
+}
+
+// BlockByHash returns a known block, canonical or not.
+func (c *Chain) BlockByHash(hash string) (Block, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return treeReader{c}.BlockByHash(hash)
+}
+
+// CanonicalBlocks returns a copy of the canonical chain.
+func (c *Chain) CanonicalBlocks() []Block {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	blocks := make([]Block, len(c.Blocks))
+	copy(blocks, c.Blocks)
+	return blocks
+}
+
+// TotalWork returns the cumulative work of the canonical chain.
+func (c *Chain) TotalWork() *big.Int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return new(big.Int).Set(c.head.totalWork)
 }
 
 func (c *Chain) LatestBlock() Block {
@@ -45,58 +154,183 @@ func (c *Chain) LatestBlock() Block {
 	return c.Blocks[len(c.Blocks)-1]
 }
 
-func (c *Chain) GetBalance(addr string) int {
+// StateRootAfter returns the state root that applying txs on top of the tip
+// would produce in a block without a coinbase.
+func (c *Chain) StateRootAfter(txs []Transaction) (string, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.State[addr]
+	st := c.newStateTransition()
+	for i := range txs {
+		if err := st.apply(&txs[i]); err != nil {
+			return "", &TxError{Index: i, ID: txs[i].ID(), Err: err}
+		}
+	}
+	return st.overlay.root(), nil
 }
 
-func (c *Chain) AddBalance(addr string, amount int) int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.State[addr] += amount
-	return c.State[addr]
+// FindTransaction locates a transaction by ID in the canonical chain and
+// returns its block and index within it.
+func (c *Chain) FindTransaction(id string) (Block, int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := len(c.Blocks) - 1; i >= 0; i-- {
+		for j := range c.Blocks[i].Transactions {
+			if c.Blocks[i].Transactions[j].ID() == id {
+				return c.Blocks[i], j, nil
+			}
+		}
+	}
+	return Block{}, 0, ErrTxNotFound
 }
 
-func (c *Chain) SetBalance(addr string, amount int) int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.State[addr] = amount
+// CheckTx reports whether tx would be accepted in a block on top of the head.
+func (c *Chain) CheckTx(tx *Transaction) error {
+	return c.NewStateTransition().Apply(tx)
+}
+
+// CheckTxs checks txs in order against the head state, each on top of the
+// ones before it that passed, and returns those that fail.
+func (c *Chain) CheckTxs(txs []Transaction) []RejectedTx {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	st := c.newStateTransition()
+	var rejected []RejectedTx
+	for i := range txs {
+		if err := st.apply(&txs[i]); err != nil {
+			rejected = append(rejected, RejectedTx{Tx: txs[i], Err: err})
+		}
+	}
+	return rejected
+}
+
+// StakingAt returns the staking ledger as of a known block. It must not be modified.
+func (c *Chain) StakingAt(hash string) (*StakingState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return treeReader{c}.StakingAt(hash)
+}
+
+// Staking returns a copy of the staking ledger at the head.
+func (c *Chain) Staking() *StakingState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.head.staking.copy()
+}
+
+// GetStake returns the stake addr has bonded at the head.
+func (c *Chain) GetStake(addr string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.head.staking.Stakes[NormalizeAddress(addr)]
+}
+
+func (c *Chain) stakingConfig() StakingConfig {
+	return c.genesis.StakingConfig()
+}
+
+func (c *Chain) rewardConfig() RewardConfig {
+	return c.genesis.RewardConfig()
+}
+
+// ChainID returns the network ID transactions must be signed for.
+func (c *Chain) ChainID() uint64 {
+	return c.genesis.ChainID
+}
+
+func (c *Chain) gasConfig() GasConfig {
+	return c.genesis.GasConfig()
+}
+
+// MinGasPrice returns the lowest gas price a transaction may pay.
+func (c *Chain) MinGasPrice() int {
+	return c.gasConfig().MinGasPrice
+}
+
+func (c *Chain) GetBalance(addr string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.State[addr]
 }
 
+// View calls fn with the head state, for reading module stores. Writes fn
+// makes are discarded.
+func (c *Chain) View(fn func(s State)) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fn(c.newStateOverlay(c.head))
+}
+
 func (c *Chain) GetNonce(addr string) uint64 {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.Nonces[addr]
 }
 
-func (c *Chain) SetNonce(addr string, nonce uint64) {
+func (c *Chain) SetBlocks(blocks []Block) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.Nonces[addr] = nonce
+	c.Blocks = append([]Block(nil), blocks...)
 }
 
-func (c *Chain) SetBlocks(blocks []Block) {
+// Restore replaces everything after genesis with blocks loaded from storage.
+// Storage does not keep the genesis block, so a leading block 0 is ignored.
+// Every stored block is validated again like a received one, seal included;
+// the chain is restored up to the first block that fails, which is returned
+// as the error.
+func (c *Chain) Restore(blocks []Block) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.Blocks = append([]Block(nil), blocks...)
+	stored := []Block{c.Blocks[0]}
+	for _, b := range blocks {
+		if b.Number != 0 {
+			stored = append(stored, b)
+		}
+	}
+	c.Blocks = stored
+	return c.rebuild()
 }
 
+// RebuildStateFromBlocks recomputes balances, nonces and the block tree from
+// Blocks, validating each block again.
 func (c *Chain) RebuildStateFromBlocks() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if err := c.rebuild(); err != nil {
+		log.Println("warning: rebuilding state:", err)
+	}
+}
+
+// rebuild is RebuildStateFromBlocks for callers holding c.mu. If the genesis
+// hook or a block fails, Blocks is cut short before it and the error returned.
+func (c *Chain) rebuild() error {
 	c.State = make(map[string]int)
 	c.Nonces = make(map[string]uint64)
-	for _, b := range c.Blocks {
-		for _, tx := range b.Transactions {
-			c.State[tx.From] -= tx.Amount
-			c.State[tx.To] += tx.Amount
-			if tx.Nonce > c.Nonces[tx.From] {
-				c.Nonces[tx.From] = tx.Nonce
-			}
+	c.kv = make(map[string][]byte)
+	if c.genesis != nil {
+		for addr, bal := range c.genesis.Alloc {
+			c.State[addr] = bal
+		}
+	}
+	blocks := c.Blocks
+	c.Blocks = blocks[:1:1]
+	c.nodes = make(map[string]*blockNode, len(blocks))
+	c.head = c.genesisNode(blocks[0])
+	if err := c.initGenesis(); err != nil {
+		return err
+	}
+	for _, b := range blocks[1:] {
+		parent, err := c.validateStateless(&b, c.sealVerifier)
+		if err == nil && parent != c.head {
+			err = rejectBlock(&b, StageHeader, fmt.Errorf("%w: does not extend block %d", ErrUnknownParent, c.head.block.Number))
+		}
+		if err == nil {
+			_, err = c.insertBlock(parent, b)
+		}
+		if err != nil {
+			return fmt.Errorf("stored chain invalid after block %d: %w", c.head.block.Number, err)
 		}
 	}
+	return nil
 }
 
 func (c *Chain) CreateGenesisIfNotExists() {
@@ -108,10 +342,39 @@ func (c *Chain) CreateGenesisIfNotExists() {
 	if c.Nonces == nil {
 		c.Nonces = make(map[string]uint64)
 	}
+	if c.kv == nil {
+		c.kv = make(map[string][]byte)
+	}
 	if len(c.Blocks) > 0 {
 		return
 	}
-	c.Blocks = append(c.Blocks, Block{Number: 0, PrevHash: "", Timestamp: 0})
-	c.State["0x742d35Cc6634C0532925a3b844Bc454e4438f44e"] = 1000
-	c.State["0x742d35Cc6634C0532925a3b844Bc454e4438f44f"] = 1000
+	if c.genesis == nil {
+		c.genesis = DefaultGenesis()
+	}
+	genesis := c.genesis.Block()
+	c.Blocks = append(c.Blocks, genesis)
+	for addr, bal := range c.genesis.Alloc {
+		c.State[addr] = bal
+	}
+	c.nodes = make(map[string]*blockNode)
+	c.head = c.genesisNode(genesis)
+}
+
+// genesisNode adds the genesis block to the tree and starts the state trie
+// from the genesis balances in State. Callers must hold c.mu.
+func (c *Chain) genesisNode(genesis Block) *blockNode {
+	n := &blockNode{
+		block:     genesis,
+		totalWork: new(big.Int),
+		undo:      &stateUndo{},
+		staking:   newStakingState(c.stakingConfig().Stakes),
+	}
+	c.trie = nil
+	for addr := range c.State {
+		c.syncAccount(addr)
+	}
+	c.trie = c.trie.setStaking(n.staking)
+	n.trie = c.trie
+	c.nodes[genesis.Hash] = n
+	return n
 }
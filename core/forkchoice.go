@@ -0,0 +1,155 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ErrStateCorrupted means the chain could not restore its canonical state
+// after a failed reorg. The node must not keep running on it.
+var ErrStateCorrupted = errors.New("chain state corrupted")
+
+// BlockWorker is implemented by consensus engines that weigh blocks for fork
+// choice, e.g. PoW by difficulty. Without one every block counts as 1, so the
+// longest chain wins.
+type BlockWorker interface {
+	BlockWork(chain ChainReader, b Block) *big.Int
+}
+
+// ChainEvent reports a change of the canonical chain. On a reorg Removed holds
+// the abandoned blocks (highest first) and Added the new branch (lowest first).
+type ChainEvent struct {
+	Added   []Block
+	Removed []Block
+}
+
+// blockNode is a block in the tree of every valid block seen, canonical or not.
+type blockNode struct {
+	block     Block
+	parent    *blockNode
+	totalWork *big.Int
+	undo      *stateUndo    // non-nil while the block is part of the canonical chain
+	staking   *StakingState // ledger after the block, once it has been canonical
+	trie      *trieNode     // state after the block, once it has been canonical
+}
+
+func (c *Chain) blockWork(b *Block) *big.Int {
+	if w, ok := c.sealVerifier.(BlockWorker); ok {
+		return w.BlockWork(treeReader{c}, *b)
+	}
+	return big.NewInt(1)
+}
+
+// insertBlock adds a block that already passed stateless validation to the
+// tree and makes it canonical if it carries the most work. Callers must hold c.mu.
+func (c *Chain) insertBlock(parent *blockNode, b Block) (ChainEvent, error) {
+	node := &blockNode{
+		block:     b,
+		parent:    parent,
+		totalWork: new(big.Int).Add(parent.totalWork, c.blockWork(&b)),
+	}
+	if parent == c.head {
+		overlay, err := c.validateState(&b)
+		if err != nil {
+			return ChainEvent{}, err
+		}
+		c.nodes[b.Hash] = node
+		c.commitBlock(overlay, node)
+		c.Blocks = append(c.Blocks, b)
+		c.head = node
+		return ChainEvent{Added: []Block{b}}, nil
+	}
+	// a side block's state is only worked out by reorg, on top of its real parent
+	c.nodes[b.Hash] = node
+	if node.totalWork.Cmp(c.head.totalWork) <= 0 {
+		// side chain with less or equal work: keep it in case it overtakes
+		return ChainEvent{}, nil
+	}
+	return c.reorg(node)
+}
+
+// reorg switches the canonical chain to end at newHead, rolling state back to
+// the common ancestor and forward along the new branch. If a block on the new
+// branch fails state validation the old chain is restored and the invalid
+// block and its descendants are forgotten. The old chain's blocks are put
+// back from what they wrote, without validating them again.
+func (c *Chain) reorg(newHead *blockNode) (ChainEvent, error) {
+	var branch []*blockNode
+	ancestor := newHead
+	for ancestor.undo == nil {
+		branch = append(branch, ancestor)
+		ancestor = ancestor.parent
+	}
+
+	var removed []*blockNode
+	var redo []*stateOverlay
+	for n := c.head; n != ancestor; n = n.parent {
+		removed = append(removed, n)
+		redo = append(redo, c.unapply(n))
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		n := branch[i]
+		overlay, err := c.validateState(&n.block)
+		if err == nil {
+			c.commitBlock(overlay, n)
+			c.Blocks = append(c.Blocks, n.block)
+			c.head = n
+			continue
+		}
+		// roll back the part of the new branch applied so far, then restore the old chain
+		for j := i + 1; j < len(branch); j++ {
+			c.unapply(branch[j])
+		}
+		c.dropSubtree(n)
+		for j := len(removed) - 1; j >= 0; j-- {
+			c.commitBlock(redo[j], removed[j])
+			c.Blocks = append(c.Blocks, removed[j].block)
+			c.head = removed[j]
+			if root := c.trie.root(); root != removed[j].block.StateRoot {
+				return ChainEvent{}, fmt.Errorf("%w: restoring block %d: state root %s, want %s",
+					ErrStateCorrupted, removed[j].block.Number, root, removed[j].block.StateRoot)
+			}
+		}
+		return ChainEvent{}, err
+	}
+
+	ev := ChainEvent{}
+	for _, n := range removed {
+		ev.Removed = append(ev.Removed, n.block)
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		ev.Added = append(ev.Added, branch[i].block)
+	}
+	return ev, nil
+}
+
+// unapply reverts the head block's state changes and pops it off Blocks. It
+// returns the block's changes as an overlay that commits them again.
+func (c *Chain) unapply(n *blockNode) *stateOverlay {
+	redo := n.undo.redo(c, n)
+	n.undo.revert(c)
+	n.undo = nil
+	c.Blocks = c.Blocks[:len(c.Blocks)-1]
+	c.head = n.parent
+	c.trie = c.trie.setStaking(c.head.staking)
+	return redo
+}
+
+// dropSubtree forgets n and every block built on it.
+func (c *Chain) dropSubtree(n *blockNode) {
+	doomed := map[*blockNode]bool{n: true}
+	for changed := true; changed; {
+		changed = false
+		for hash, other := range c.nodes {
+			if doomed[other.parent] && !doomed[other] {
+				doomed[other] = true
+				changed = true
+			}
+			if doomed[other] {
+				delete(c.nodes, hash)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Gas charged per transaction. Every transaction costs a fixed amount by
+// type; staking costs more since it also changes the staking ledger.
+const (
+	GasTransfer uint64 = 21
+	GasStaking  uint64 = 50
+)
+
+var (
+	ErrIntrinsicGas     = errors.New("gas limit below the transaction's gas")
+	ErrInvalidGasPrice  = errors.New("gas price out of range")
+	ErrGasPriceTooLow   = errors.New("gas price below minimum")
+	ErrBlockGasExceeded = errors.New("block gas limit exceeded")
+)
+
+// GasConfig sets the chain's gas rules.
+type GasConfig struct {
+	BlockGasLimit uint64 `json:"blockGasLimit"` // total gas of a block's transactions; 0 is unlimited
+	MinGasPrice   int    `json:"minGasPrice"`
+}
+
+func DefaultGasConfig() GasConfig {
+	return GasConfig{BlockGasLimit: 21000, MinGasPrice: 1}
+}
+
+// Gas returns the gas tx uses.
+func (tx *Transaction) Gas() uint64 {
+	if tx.Type == TxBond || tx.Type == TxUnbond {
+		return GasStaking
+	}
+	return GasTransfer
+}
+
+// Fee is what tx pays the block's coinbase: the gas it uses at its gas price.
+func (tx *Transaction) Fee() int {
+	return int(tx.Gas()) * tx.GasPrice
+}
+
+// Gas sums the gas of b's transactions.
+func (b *Block) Gas() uint64 {
+	var gas uint64
+	for i := range b.Transactions {
+		gas += b.Transactions[i].Gas()
+	}
+	return gas
+}
+
+// validateGas performs the state-independent gas checks on tx.
+func validateGas(tx *Transaction) error {
+	if tx.GasPrice < 0 || tx.GasPrice > math.MaxInt/int(GasStaking) {
+		return fmt.Errorf("%w: %d", ErrInvalidGasPrice, tx.GasPrice)
+	}
+	if gas := tx.Gas(); tx.GasLimit < gas {
+		return fmt.Errorf("%w: limit %d, need %d", ErrIntrinsicGas, tx.GasLimit, gas)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Header holds the fields committed to by the block hash.
+type Header struct {
+	Number       uint64
+	PrevHash     string
+	Timestamp    int64
+	TxRoot       string // Merkle root over the transaction IDs
+	StateRoot    string // root of the state trie after the block
+	EvidenceRoot string // Merkle root over the evidence IDs
+	Coinbase     string // address credited with the block reward and fees; empty for none
+	Target       string // PoW target as 64 hex digits; the hash must not exceed it
+	Candidate    string // PoA vote: validator to add or remove, empty for no vote
+	Authorize    bool   // PoA vote: true adds Candidate, false removes it
+	Nonce        uint64
+	Signature    string // signature over SigningHash by the sealer, for signing engines
+}
+
+func (h *Header) encodeFields(buf *bytes.Buffer) {
+	writeUint64(buf, h.Number)
+	writeString(buf, h.PrevHash)
+	writeUint64(buf, uint64(h.Timestamp))
+	writeString(buf, h.TxRoot)
+	writeString(buf, h.StateRoot)
+	writeString(buf, h.EvidenceRoot)
+	writeString(buf, h.Coinbase)
+	writeString(buf, h.Target)
+	writeString(buf, h.Candidate)
+	writeBool(buf, h.Authorize)
+}
+
+// SigningHash is what a sealer signs: every field except the nonce and the
+// signature itself.
+func (h *Header) SigningHash() []byte {
+	var buf bytes.Buffer
+	h.encodeFields(&buf)
+	sum := sha256.Sum256(buf.Bytes())
+	return sum[:]
+}
+
+// SealPrefix is the encoding of every header field except the nonce. The
+// hash is sha256(SealPrefix || nonce), so miners can encode the header once
+// and only vary the trailing nonce bytes.
+func (h *Header) SealPrefix() []byte {
+	var buf bytes.Buffer
+	h.encodeFields(&buf)
+	writeString(&buf, h.Signature)
+	return buf.Bytes()
+}
+
+// ComputeHash returns the hash the block's Hash field must carry.
+func (h *Header) ComputeHash() string {
+	return HashWithNonce(h.SealPrefix(), h.Nonce)
+}
+
+// HashWithNonce hashes a seal prefix together with a candidate nonce.
+func HashWithNonce(prefix []byte, nonce uint64) string {
+	buf := make([]byte, len(prefix)+8)
+	copy(buf, prefix)
+	binary.BigEndian.PutUint64(buf[len(prefix):], nonce)
+	return fmt.Sprintf("%x", sha256.Sum256(buf))
+}
+
+func writeUint64(buf *bytes.Buffer, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[:])
+}
+
+func writeBool(buf *bytes.Buffer, v bool) {
+	if v {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+// writeString length-prefixes s so adjacent fields cannot run together.
+func writeString(buf *bytes.Buffer, s string) {
+	writeUint64(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
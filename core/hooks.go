@@ -0,0 +1,92 @@
+package core
+
+import "fmt"
+
+// Block lifecycle hooks. A TxRouter may implement any of them; the chain
+// detects them by type assertion and calls them around every block it
+// applies or builds.
+
+// GenesisInitializer writes a router's initial state on top of the genesis
+// allocation.
+type GenesisInitializer interface {
+	InitGenesis(s State, g *Genesis) error
+}
+
+// BlockBeginner runs before a block's transactions, after matured stake is
+// released and evidence is slashed. Only the header's number, parent,
+// timestamp and coinbase may be relied on: a block being built has no roots yet.
+type BlockBeginner interface {
+	BeginBlock(s State, h *Header) error
+}
+
+// BlockEnder runs after a block's transactions, before the coinbase is paid.
+// The header is as for BlockBeginner. Like transactions, a hook that fails
+// leaves none of its writes behind.
+type BlockEnder interface {
+	EndBlock(s State, h *Header) error
+}
+
+// BlockCommitter is told about every block whose state has been written to
+// the chain, including blocks re-applied by a reorg or rebuild. It runs with
+// the chain locked and must not call back into it.
+type BlockCommitter interface {
+	Commit(b *Block)
+}
+
+func (s *stateOverlay) beginBlock(h *Header) error {
+	if hook, ok := s.chain.router.(BlockBeginner); ok {
+		hs := s.child()
+		if err := hook.BeginBlock(hs, h); err != nil {
+			return fmt.Errorf("begin block: %w", err)
+		}
+		hs.flush()
+	}
+	return nil
+}
+
+func (s *stateOverlay) endBlock(h *Header) error {
+	if hook, ok := s.chain.router.(BlockEnder); ok {
+		hs := s.child()
+		if err := hook.EndBlock(hs, h); err != nil {
+			return fmt.Errorf("end block: %w", err)
+		}
+		hs.flush()
+	}
+	return nil
+}
+
+// commitBlock writes overlay, the state of n's block, to the chain and keeps
+// its ledger, undo record and trie in n. Callers must hold c.mu.
+func (c *Chain) commitBlock(overlay *stateOverlay, n *blockNode) {
+	n.staking = overlay.staking
+	n.undo = overlay.commit()
+	n.trie = c.trie
+	if hook, ok := c.router.(BlockCommitter); ok {
+		hook.Commit(&n.block)
+	}
+}
+
+// initGenesis runs the router's genesis hook on the genesis state and makes
+// the genesis block commit to what it wrote, so networks with different
+// module genesis data differ from genesis on. Callers must hold c.mu with
+// the head at genesis.
+func (c *Chain) initGenesis() error {
+	hook, ok := c.router.(GenesisInitializer)
+	if !ok {
+		return nil
+	}
+	overlay := c.newStateOverlay(c.head)
+	overlay.number = 0
+	if err := hook.InitGenesis(overlay, c.genesis); err != nil {
+		return fmt.Errorf("init genesis: %w", err)
+	}
+	c.head.staking = overlay.staking
+	overlay.commit()
+	genesis := c.genesis.block(c.trie.root())
+	delete(c.nodes, c.head.block.Hash)
+	c.head.block = genesis
+	c.head.trie = c.trie
+	c.nodes[genesis.Hash] = c.head
+	c.Blocks[0] = genesis
+	return nil
+}
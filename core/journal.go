@@ -0,0 +1,108 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+)
+
+// txJournal is an append-only file of the transactions accepted into the
+// mempool, one JSON object per line, so they survive a restart.
+type txJournal struct {
+	path   string
+	writer *os.File
+}
+
+// load passes every journaled transaction to add and reports how many it
+// read and how many add refused. A missing journal is empty; a truncated last
+// line, as left by a crash mid-write, ends the journal.
+func (j *txJournal) load(add func(Transaction) error) (total, dropped int, err error) {
+	f, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var tx Transaction
+		if err := dec.Decode(&tx); err != nil {
+			if err != io.EOF {
+				log.Printf("warning: mempool journal %s: %v", j.path, err)
+			}
+			return total, dropped, nil
+		}
+		total++
+		if add(tx) != nil {
+			dropped++
+		}
+	}
+}
+
+func (j *txJournal) insert(tx Transaction) error {
+	if j.writer == nil {
+		return errors.New("mempool journal not open")
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	_, err = j.writer.Write(append(data, '\n'))
+	return err
+}
+
+// rotate replaces the journal with txs and reopens it for appending. The new
+// contents are written aside and renamed over the old so a crash leaves one
+// or the other intact.
+func (j *txJournal) rotate(txs []Transaction) error {
+	if j.writer != nil {
+		if err := j.writer.Close(); err != nil {
+			return err
+		}
+		j.writer = nil
+	}
+	tmp := j.path + ".new"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range txs {
+		if err := enc.Encode(&txs[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	j.writer, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+func (j *txJournal) close() error {
+	if j.writer == nil {
+		return nil
+	}
+	err := j.writer.Close()
+	j.writer = nil
+	return err
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newJournaledPool returns a pool checked against c that journals to path.
+func newJournaledPool(t *testing.T, c *Chain, path string) *Mempool {
+	t.Helper()
+	m := NewMempool()
+	m.SetNonceSource(c.GetNonce)
+	m.SetValidator(c.CheckTxs)
+	if err := m.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.CloseJournal() })
+	return m
+}
+
+func readJournal(t *testing.T, path string) []Transaction {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txs []Transaction
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var tx Transaction
+		if err := dec.Decode(&tx); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+func TestJournalReplay(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	m := newJournaledPool(t, c, path)
+	txs := []Transaction{a.transfer(t, 1, 1, 1), a.transfer(t, 2, 1, 1), a.transfer(t, 4, 1, 1)}
+	for _, tx := range txs {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.CloseJournal(); err != nil {
+		t.Fatal(err)
+	}
+
+	m = newJournaledPool(t, c, path)
+	if got := nonces(m.Pending()[a.addr]); fmt.Sprint(got) != "[1 2]" {
+		t.Errorf("pending nonces %v, want [1 2]", got)
+	}
+	if got := nonces(m.Queued()[a.addr]); fmt.Sprint(got) != "[4]" {
+		t.Errorf("queued nonces %v, want [4]", got)
+	}
+}
+
+func TestJournalRotate(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	m := newJournaledPool(t, c, path)
+	old := a.transfer(t, 1, 1, 1)
+	replacement := a.transfer(t, 1, 1, 2)
+	second := a.transfer(t, 2, 1, 1)
+	for _, tx := range []Transaction{old, replacement, second} {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(readJournal(t, path)); got != 3 {
+		t.Fatalf("%d journaled before compaction, want 3", got)
+	}
+	m.ClearMined([]Transaction{second})
+	if err := m.RotateJournal(); err != nil {
+		t.Fatal(err)
+	}
+	got := readJournal(t, path)
+	if len(got) != 1 || got[0].ID() != replacement.ID() {
+		t.Fatalf("journal holds %v, want the replacement alone", got)
+	}
+	if _, err := os.Stat(path + ".new"); !os.IsNotExist(err) {
+		t.Errorf("temporary journal left behind: %v", err)
+	}
+
+	// the journal is appended to again after compaction
+	if err := m.Push(second); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(readJournal(t, path)); got != 2 {
+		t.Errorf("%d journaled after push, want 2", got)
+	}
+}
+
+func TestJournalTruncated(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	var data []byte
+	for _, tx := range []Transaction{a.transfer(t, 1, 1, 1), a.transfer(t, 2, 1, 1)} {
+		line, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	// a crash cut the second record short
+	data = data[:len(data)-20]
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newJournaledPool(t, c, path)
+	if got := nonces(m.Pending()[a.addr]); fmt.Sprint(got) != "[1]" {
+		t.Errorf("pending nonces %v, want [1]", got)
+	}
+	// compaction on open leaves only whole records
+	if got := len(readJournal(t, path)); got != 1 {
+		t.Errorf("%d journaled after open, want 1", got)
+	}
+}
+
+func TestJournalRejectsInvalid(t *testing.T) {
+	a, b := newTestAccount(t), newTestAccount(t)
+	c := newTestChain(t, 1000, a, b)
+	path := filepath.Join(t.TempDir(), "journal")
+
+	valid := a.transfer(t, 1, 1, 1)
+	forged := a.transfer(t, 2, 1, 1)
+	forged.Amount = 500 // changed after signing
+	used := b.transfer(t, 1, 1, 1)
+	c.Nonces[b.addr] = 1
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := json.NewEncoder(f)
+	for _, tx := range []Transaction{valid, forged, used} {
+		if err := enc.Encode(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newJournaledPool(t, c, path)
+	if m.Len() != 1 {
+		t.Fatalf("%d pooled, want the valid tx alone", m.Len())
+	}
+	if _, ok := m.all[valid.ID()]; !ok {
+		t.Error("valid tx not replayed")
+	}
+	if got := readJournal(t, path); len(got) != 1 || got[0].ID() != valid.ID() {
+		t.Errorf("journal holds %v after open, want the valid tx alone", got)
+	}
+}
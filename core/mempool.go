@@ -1,76 +1,573 @@
 package core
 
-import "sync"
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+)
 
+var (
+	ErrAlreadyKnown        = errors.New("transaction already in mempool")
+	ErrReplaceUnderpriced  = errors.New("replacement transaction underpriced")
+	ErrMempoolFull         = errors.New("mempool full")
+	ErrAccountMempoolLimit = errors.New("sender has too many pooled transactions")
+	ErrNonceGap            = errors.New("waiting for an earlier nonce")
+)
+
+// MempoolConfig bounds the mempool. Zero values disable the corresponding limit.
+type MempoolConfig struct {
+	MaxTxs        int           // transactions across all senders
+	MaxPerAccount int           // transactions per sender
+	TTL           time.Duration // how long a transaction may wait before it is dropped
+	PriceBump     int           // percent by which a replacement's gas price must exceed the original's
+}
+
+func DefaultMempoolConfig() MempoolConfig {
+	return MempoolConfig{MaxTxs: 4096, MaxPerAccount: 64, TTL: 3 * time.Hour, PriceBump: 10}
+}
+
+// Mempool holds transactions waiting for a block, kept per sender in nonce
+// order. A sender's pending transactions are the run of consecutive nonces
+// following its account nonce; anything after a gap is queued until the gap
+// is filled. Blocks take pending transactions, highest gas price first
+// across senders and in nonce order within each sender.
 type Mempool struct {
-	Mu  sync.RWMutex
-	Txs []Transaction
+	config      MempoolConfig
+	mu          sync.RWMutex
+	accounts    map[string][]*pooledTx // by sender, sorted by nonce
+	all         map[string]*pooledTx   // by ID
+	seq         uint64
+	nonceOf     func(addr string) uint64
+	validate    func(txs []Transaction) []RejectedTx
+	journal     *txJournal
+	subscribers []func(Transaction)
 }
 
-func NewMempool() *Mempool { return &Mempool{} }
+type pooledTx struct {
+	tx    Transaction
+	id    string
+	seq   uint64 // arrival order, breaks gas price ties
+	added time.Time
+}
 
-func (m *Mempool) Push(tx Transaction) {
-	m.Mu.Lock()
-	m.Txs = append(m.Txs, tx)
-	m.Mu.Unlock()
+func NewMempool() *Mempool {
+	return NewMempoolWithConfig(DefaultMempoolConfig())
 }
 
-func (m *Mempool) PopMany(n int) []Transaction {
-	m.Mu.Lock()
-	defer m.Mu.Unlock()
-	if n <= 0 || len(m.Txs) == 0 {
+func NewMempoolWithConfig(cfg MempoolConfig) *Mempool {
+	return &Mempool{
+		config:   cfg,
+		accounts: make(map[string][]*pooledTx),
+		all:      make(map[string]*pooledTx),
+	}
+}
+
+// SetNonceSource tells the pool each account's current nonce, usually
+// Chain.GetNonce. Without one, a sender's lowest pooled nonce starts its
+// pending run.
+func (m *Mempool) SetNonceSource(fn func(addr string) uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nonceOf = fn
+}
+
+// SetValidator sets the check Revalidate runs on each sender's pending
+// transactions, usually Chain.CheckTxs.
+func (m *Mempool) SetValidator(fn func(txs []Transaction) []RejectedTx) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validate = fn
+}
+
+// Subscribe registers fn to be called with every transaction pushed to the
+// pool. fn runs without the pool lock held.
+func (m *Mempool) Subscribe(fn func(Transaction)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// Push adds tx to its sender's queue. A transaction with the same sender and
+// nonce as a pooled one replaces it if its gas price is higher by the
+// configured bump; blocks and eviction rank by gas price, so a larger gas
+// limit alone does not count. When the pool is full, the cheapest transaction
+// that ends a sender's queue is evicted to make room, provided tx pays a
+// higher gas price.
+func (m *Mempool) Push(tx Transaction) error {
+	m.mu.Lock()
+	if err := m.add(tx); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if m.journal != nil {
+		if err := m.journal.insert(tx); err != nil {
+			log.Println("warning: failed to journal tx:", err)
+		}
+	}
+	subscribers := m.subscribers
+	m.mu.Unlock()
+	for _, fn := range subscribers {
+		fn(tx)
+	}
+	return nil
+}
+
+func (m *Mempool) add(tx Transaction) error {
+	now := time.Now()
+	m.expire(now)
+	id := tx.ID()
+	if _, ok := m.all[id]; ok {
+		return ErrAlreadyKnown
+	}
+	ptx := &pooledTx{tx: tx, id: id, added: now}
+	list := m.accounts[tx.From]
+	i := sort.Search(len(list), func(i int) bool { return list[i].tx.Nonce >= tx.Nonce })
+	if i < len(list) && list[i].tx.Nonce == tx.Nonce {
+		old := list[i]
+		if !m.bumped(old.tx.GasPrice, tx.GasPrice) {
+			return fmt.Errorf("%w: gas price %d, need more than %d plus %d%%", ErrReplaceUnderpriced, tx.GasPrice, old.tx.GasPrice, m.config.PriceBump)
+		}
+		delete(m.all, old.id)
+		m.seq++
+		ptx.seq = m.seq
+		list[i] = ptx
+		m.all[id] = ptx
 		return nil
 	}
-	if n > len(m.Txs) {
-		n = len(m.Txs)
+	if limit := m.config.MaxPerAccount; limit > 0 && len(list) >= limit {
+		return fmt.Errorf("%w: %d", ErrAccountMempoolLimit, limit)
 	}
-	slice := m.Txs[:n]
-	m.Txs = m.Txs[n:]
-	return slice
+	if limit := m.config.MaxTxs; limit > 0 && len(m.all) >= limit {
+		victim := m.cheapestTail()
+		if victim == nil || victim.tx.GasPrice >= tx.GasPrice {
+			return fmt.Errorf("%w: %d transactions", ErrMempoolFull, limit)
+		}
+		m.remove(victim)
+		list = m.accounts[tx.From]
+		i = sort.Search(len(list), func(i int) bool { return list[i].tx.Nonce >= tx.Nonce })
+	}
+	m.seq++
+	ptx.seq = m.seq
+	list = append(list, nil)
+	copy(list[i+1:], list[i:])
+	list[i] = ptx
+	m.accounts[tx.From] = list
+	m.all[id] = ptx
+	return nil
+}
+
+// bumped reports whether price exceeds old by at least the configured bump.
+func (m *Mempool) bumped(old, price int) bool {
+	if price <= old {
+		return false
+	}
+	// in big.Int so a large price cannot overflow
+	need := new(big.Int).Mul(big.NewInt(int64(old)), big.NewInt(int64(100+m.config.PriceBump)))
+	have := new(big.Int).Mul(big.NewInt(int64(price)), big.NewInt(100))
+	return have.Cmp(need) >= 0
 }
 
+// cheapestTail returns the lowest-priced transaction among the last of each
+// sender's queue, the newest on ties. Evicting from the tail never leaves a
+// gap. Callers must hold m.mu.
+func (m *Mempool) cheapestTail() *pooledTx {
+	var victim *pooledTx
+	for _, list := range m.accounts {
+		last := list[len(list)-1]
+		if victim == nil || last.tx.GasPrice < victim.tx.GasPrice ||
+			(last.tx.GasPrice == victim.tx.GasPrice && last.seq > victim.seq) {
+			victim = last
+		}
+	}
+	return victim
+}
+
+// remove drops ptx from the pool. Callers must hold m.mu.
+func (m *Mempool) remove(ptx *pooledTx) {
+	delete(m.all, ptx.id)
+	sender := ptx.tx.From
+	list := m.accounts[sender]
+	for i := range list {
+		if list[i] == ptx {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(m.accounts, sender)
+	} else {
+		m.accounts[sender] = list
+	}
+}
+
+// expire drops transactions that have waited longer than the TTL. Callers
+// must hold m.mu for writing.
+func (m *Mempool) expire(now time.Time) {
+	if m.config.TTL <= 0 {
+		return
+	}
+	for _, ptx := range m.all {
+		if now.Sub(ptx.added) > m.config.TTL {
+			m.remove(ptx)
+		}
+	}
+}
+
+// Expire drops transactions that have outlived the TTL. The pool also
+// expires transactions whenever one is pushed or a block is built.
+func (m *Mempool) Expire() {
+	m.mu.Lock()
+	m.expire(time.Now())
+	m.mu.Unlock()
+}
+
+// split returns the pending and queued parts of a sender's list. Transactions
+// with nonces the account has already used are in neither. Callers must hold m.mu.
+func (m *Mempool) split(sender string, list []*pooledTx) (pending, queued []*pooledTx) {
+	if len(list) == 0 {
+		return nil, nil
+	}
+	next := list[0].tx.Nonce
+	if m.nonceOf != nil {
+		next = m.nonceOf(sender) + 1
+	}
+	i := sort.Search(len(list), func(i int) bool { return list[i].tx.Nonce >= next })
+	j := i
+	for j < len(list) && list[j].tx.Nonce == next {
+		next++
+		j++
+	}
+	return list[i:j], list[j:]
+}
+
+// PendingTransactions returns the pending transactions in the order a block
+// should include them.
 func (m *Mempool) PendingTransactions() []Transaction {
-	m.Mu.RLock()
-	defer m.Mu.RUnlock()
-	if len(m.Txs) == 0 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(time.Now())
+	var h senderHeap
+	total := 0
+	for sender, list := range m.accounts {
+		if pending, _ := m.split(sender, list); len(pending) > 0 {
+			h = append(h, pending)
+			total += len(pending)
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	heap.Init(&h)
+	txs := make([]Transaction, 0, total)
+	for h.Len() > 0 {
+		txs = append(txs, h[0][0].tx)
+		if h[0] = h[0][1:]; len(h[0]) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return txs
+}
+
+// senderHeap orders senders' pending runs by the gas price of their next
+// transaction, then by arrival.
+type senderHeap [][]*pooledTx
+
+func (h senderHeap) Len() int { return len(h) }
+func (h senderHeap) Less(i, j int) bool {
+	a, b := h[i][0], h[j][0]
+	if a.tx.GasPrice != b.tx.GasPrice {
+		return a.tx.GasPrice > b.tx.GasPrice
+	}
+	return a.seq < b.seq
+}
+func (h senderHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *senderHeap) Push(x any)   { *h = append(*h, x.([]*pooledTx)) }
+func (h *senderHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Pending and Queued return copies of the pool's transactions by sender.
+func (m *Mempool) Pending() map[string][]Transaction { return m.content(true) }
+func (m *Mempool) Queued() map[string][]Transaction  { return m.content(false) }
+
+func (m *Mempool) content(pending bool) map[string][]Transaction {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[string][]Transaction)
+	for sender, list := range m.accounts {
+		p, q := m.split(sender, list)
+		if !pending {
+			p = q
+		}
+		for _, ptx := range p {
+			out[sender] = append(out[sender], ptx.tx)
+		}
+	}
+	return out
+}
+
+// PendingNonce returns the nonce a sender's next transaction should use to
+// extend its pending run.
+func (m *Mempool) PendingNonce(addr string) uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	next := uint64(1)
+	if m.nonceOf != nil {
+		next = m.nonceOf(addr) + 1
+	}
+	if pending, _ := m.split(addr, m.accounts[addr]); len(pending) > 0 {
+		next = pending[len(pending)-1].tx.Nonce + 1
+	}
+	return next
+}
+
+// PopMany removes and returns up to n pending transactions in block order.
+func (m *Mempool) PopMany(n int) []Transaction {
+	if n <= 0 {
 		return nil
 	}
-	txs := make([]Transaction, len(m.Txs))
-	copy(txs, m.Txs)
+	txs := m.PendingTransactions()
+	if len(txs) > n {
+		txs = txs[:n]
+	}
+	m.ClearMined(txs)
 	return txs
 }
 
+// ClearMined removes txs from the pool, leaving everything else in place.
 func (m *Mempool) ClearMined(txs []Transaction) {
 	if len(txs) == 0 {
 		return
 	}
-	ids := make(map[string]struct{}, len(txs))
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for i := range txs {
-		ids[txs[i].ID()] = struct{}{}
+		if ptx, ok := m.all[txs[i].ID()]; ok {
+			m.remove(ptx)
+		}
 	}
-	m.Mu.Lock()
-	defer m.Mu.Unlock()
-	if len(m.Txs) == 0 {
-		return
+}
+
+// Revalidate checks the pool against the current chain state. Transactions
+// whose nonce has been used, and pending ones the validator rejects, are
+// dropped; pending transactions behind a dropped one are demoted to queued
+// until the gap is filled again. Both are returned with the reason.
+// The validator runs without the pool locked, so it may take the chain's lock.
+func (m *Mempool) Revalidate() (dropped, demoted []RejectedTx) {
+	m.mu.Lock()
+	validate := m.validate
+	pendingOf := make(map[string][]Transaction)
+	for sender, list := range m.accounts {
+		if m.nonceOf != nil {
+			cur := m.nonceOf(sender)
+			var stale []*pooledTx
+			for _, ptx := range list {
+				if ptx.tx.Nonce <= cur {
+					stale = append(stale, ptx)
+				}
+			}
+			for _, ptx := range stale {
+				m.remove(ptx)
+				dropped = append(dropped, RejectedTx{Tx: ptx.tx, Err: fmt.Errorf("%w: %d", ErrInvalidNonce, ptx.tx.Nonce)})
+			}
+		}
+		if validate == nil {
+			continue
+		}
+		pending, _ := m.split(sender, m.accounts[sender])
+		for _, ptx := range pending {
+			pendingOf[sender] = append(pendingOf[sender], ptx.tx)
+		}
+	}
+	m.mu.Unlock()
+
+	rejectedOf := make(map[string][]RejectedTx)
+	for sender, txs := range pendingOf {
+		// the followers of a rejected transaction fail for the gap it leaves;
+		// they are demoted below, not dropped
+		for _, r := range validate(txs) {
+			if !errors.Is(r.Err, ErrNonceGap) {
+				rejectedOf[sender] = append(rejectedOf[sender], r)
+			}
+		}
+	}
+	if len(rejectedOf) == 0 {
+		return dropped, demoted
 	}
-	filtered := m.Txs[:0]
-	for i := range m.Txs {
-		if _, ok := ids[m.Txs[i].ID()]; ok {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sender, rejected := range rejectedOf {
+		// the pool may have changed meanwhile: only what is still there goes
+		var gap uint64
+		removed := false
+		for _, r := range rejected {
+			ptx, ok := m.all[r.Tx.ID()]
+			if !ok {
+				continue
+			}
+			if !removed || r.Tx.Nonce < gap {
+				gap = r.Tx.Nonce
+			}
+			removed = true
+			m.remove(ptx)
+			dropped = append(dropped, r)
+		}
+		if !removed {
 			continue
 		}
-		filtered = append(filtered, m.Txs[i])
+		txs := pendingOf[sender]
+		last := txs[len(txs)-1].Nonce
+		for _, ptx := range m.accounts[sender] {
+			if ptx.tx.Nonce > gap && ptx.tx.Nonce <= last {
+				demoted = append(demoted, RejectedTx{Tx: ptx.tx, Err: fmt.Errorf("%w: nonce %d dropped", ErrNonceGap, gap)})
+			}
+		}
 	}
-	m.Txs = filtered
+	return dropped, demoted
+}
+
+// HandleChainEvent drops transactions that made it into the canonical chain,
+// returns those from abandoned blocks to the pool and revalidates the rest
+// against the new head.
+func (m *Mempool) HandleChainEvent(ev ChainEvent) {
+	var added []Transaction
+	included := make(map[string]struct{})
+	for _, b := range ev.Added {
+		for i := range b.Transactions {
+			added = append(added, b.Transactions[i])
+			included[b.Transactions[i].ID()] = struct{}{}
+		}
+	}
+	m.ClearMined(added)
+	// returned transactions are not new: they are neither journaled nor passed
+	// to subscribers again
+	m.mu.Lock()
+	for _, b := range ev.Removed {
+		for i := range b.Transactions {
+			tx := b.Transactions[i]
+			if _, ok := included[tx.ID()]; ok {
+				continue
+			}
+			if err := m.add(tx); err != nil && !errors.Is(err, ErrAlreadyKnown) {
+				log.Printf("warning: returning reorged tx %s: %v", tx.ID(), err)
+			}
+		}
+	}
+	m.mu.Unlock()
+	dropped, demoted := m.Revalidate()
+	for i := range dropped {
+		log.Printf("dropping tx %s: %v", dropped[i].Tx.ID(), dropped[i].Err)
+	}
+	for i := range demoted {
+		log.Printf("queueing tx %s: %v", demoted[i].Tx.ID(), demoted[i].Err)
+	}
+}
+
+// OpenJournal replays the transactions journaled at path into the pool,
+// drops those no longer valid against the chain, compacts the journal to what
+// is left and appends every transaction pushed from then on. It should be
+// called once the chain has been restored and the nonce source and validator set.
+func (m *Mempool) OpenJournal(path string) error {
+	if err := m.CloseJournal(); err != nil {
+		return err
+	}
+	j := &txJournal{path: path}
+	total, refused, err := j.load(func(tx Transaction) error {
+		if err := m.check(tx); err != nil {
+			log.Printf("dropping journaled tx %s: %v", tx.ID(), err)
+			return err
+		}
+		return m.Push(tx)
+	})
+	if err != nil {
+		return err
+	}
+	dropped, _ := m.Revalidate()
+	log.Printf("mempool journal: replayed %d of %d transactions, %d no longer valid", total-refused, total, refused+len(dropped))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := j.rotate(m.transactions()); err != nil {
+		return err
+	}
+	m.journal = j
+	return nil
+}
+
+// check runs the signature and gas checks on tx and, with a validator set,
+// checks it against the head state. A nonce ahead of the account's passes:
+// the transaction waits in the queue and Revalidate checks it in turn.
+func (m *Mempool) check(tx Transaction) error {
+	if err := tx.Verify(); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	validate := m.validate
+	m.mu.RUnlock()
+	if validate == nil {
+		return nil
+	}
+	for _, r := range validate([]Transaction{tx}) {
+		if !errors.Is(r.Err, ErrNonceGap) {
+			return r.Err
+		}
+	}
+	return nil
+}
+
+// RotateJournal compacts the journal to the transactions currently pooled.
+func (m *Mempool) RotateJournal() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.journal == nil {
+		return nil
+	}
+	m.expire(time.Now())
+	return m.journal.rotate(m.transactions())
+}
+
+func (m *Mempool) CloseJournal() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.journal == nil {
+		return nil
+	}
+	err := m.journal.close()
+	m.journal = nil
+	return err
+}
+
+// transactions lists the pool by sender, in nonce order. Callers must hold m.mu.
+func (m *Mempool) transactions() []Transaction {
+	txs := make([]Transaction, 0, len(m.all))
+	for _, sender := range sortedKeys(m.accounts) {
+		for _, ptx := range m.accounts[sender] {
+			txs = append(txs, ptx.tx)
+		}
+	}
+	return txs
 }
 
 func (m *Mempool) Clear() {
-	m.Mu.Lock()
-	m.Txs = nil
-	m.Mu.Unlock()
+	m.mu.Lock()
+	m.accounts = make(map[string][]*pooledTx)
+	m.all = make(map[string]*pooledTx)
+	m.mu.Unlock()
 }
 
+// Len counts every pooled transaction, pending or queued.
 func (m *Mempool) Len() int {
-	m.Mu.RLock()
-	defer m.Mu.RUnlock()
-	return len(m.Txs)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.all)
 }
@@ -0,0 +1,459 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type testAccount struct {
+	key  *ecdsa.PrivateKey
+	addr string
+}
+
+func newTestAccount(t *testing.T) testAccount {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testAccount{key: key, addr: crypto.PubkeyToAddress(key.PublicKey).Hex()}
+}
+
+// transfer returns a signed transfer of amount to the account itself.
+func (a testAccount) transfer(t *testing.T, nonce uint64, amount, price int) Transaction {
+	t.Helper()
+	tx := Transaction{ChainID: DefaultChainID, From: a.addr, To: a.addr, Amount: amount, Nonce: nonce, GasLimit: GasTransfer, GasPrice: price}
+	a.sign(t, &tx)
+	return tx
+}
+
+func (a testAccount) sign(t *testing.T, tx *Transaction) {
+	t.Helper()
+	sig, err := crypto.Sign(tx.SigningHash(), a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = hexutil.Encode(sig)
+}
+
+// newTestChain returns a chain on the default genesis with each account funded.
+func newTestChain(t *testing.T, funds int, accounts ...testAccount) *Chain {
+	t.Helper()
+	g := DefaultGenesis()
+	for _, a := range accounts {
+		g.Alloc[a.addr] = funds
+	}
+	return NewChainWithGenesis(g)
+}
+
+// poolTx returns an unsigned transaction for tests of the pool alone, which
+// does not check signatures. The signature field only keeps IDs apart.
+func poolTx(from string, nonce uint64, price int) Transaction {
+	return Transaction{From: from, To: "to", Amount: 1, Nonce: nonce, GasLimit: GasTransfer, GasPrice: price,
+		Signature: fmt.Sprintf("%s/%d/%d", from, nonce, price)}
+}
+
+func nonces(txs []Transaction) []uint64 {
+	out := make([]uint64, len(txs))
+	for i := range txs {
+		out[i] = txs[i].Nonce
+	}
+	return out
+}
+
+func TestCheckTxNonce(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	first := a.transfer(t, 1, 1, 1)
+	if err := c.CheckTx(&first); err != nil {
+		t.Fatal(err)
+	}
+	c.Nonces[a.addr] = 3
+
+	tests := []struct {
+		name  string
+		nonce uint64
+		want  error
+	}{
+		{"used", 2, ErrInvalidNonce},
+		{"current", 3, ErrInvalidNonce},
+		{"next", 4, nil},
+		{"gap", 5, ErrNonceGap},
+		{"far ahead", 100, ErrNonceGap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := a.transfer(t, tt.nonce, 1, 1)
+			if err := c.CheckTx(&tx); !errors.Is(err, tt.want) {
+				t.Errorf("nonce %d: got %v, want %v", tt.nonce, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTxsNonceRun(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+
+	tests := []struct {
+		name     string
+		nonces   []uint64
+		rejected []uint64
+	}{
+		{"consecutive", []uint64{1, 2, 3}, nil},
+		{"gap", []uint64{1, 3}, []uint64{3}},
+		{"repeat", []uint64{1, 1}, []uint64{1}},
+		{"starts late", []uint64{2, 3}, []uint64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var txs []Transaction
+			for i, n := range tt.nonces {
+				txs = append(txs, a.transfer(t, n, i+1, 1))
+			}
+			var got []uint64
+			for _, r := range c.CheckTxs(txs) {
+				got = append(got, r.Tx.Nonce)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.rejected) {
+				t.Errorf("rejected nonces %v, want %v", got, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestPendingTransactionsOrder(t *testing.T) {
+	m := NewMempool()
+	for _, tx := range []Transaction{
+		poolTx("a", 1, 5),
+		poolTx("a", 2, 1),
+		poolTx("b", 1, 3),
+		poolTx("c", 1, 5), // same price as a's first, arrived later
+		poolTx("c", 2, 9), // cannot go before c's first
+	} {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, tx := range m.PendingTransactions() {
+		got = append(got, fmt.Sprintf("%s%d", tx.From, tx.Nonce))
+	}
+	want := "[a1 c1 c2 b1 a2]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+}
+
+func TestPendingQueuedSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		current uint64 // account nonce; 0 without a nonce source
+		source  bool
+		pooled  []uint64
+		pending []uint64
+		queued  []uint64
+	}{
+		{"run", 0, true, []uint64{1, 2, 3}, []uint64{1, 2, 3}, nil},
+		{"gap", 0, true, []uint64{1, 2, 4, 5}, []uint64{1, 2}, []uint64{4, 5}},
+		{"missing first", 0, true, []uint64{2, 3}, nil, []uint64{2, 3}},
+		{"used nonces in neither", 2, true, []uint64{1, 2, 3, 5}, []uint64{3}, []uint64{5}},
+		{"no source starts at lowest", 0, false, []uint64{7, 8, 10}, []uint64{7, 8}, []uint64{10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMempool()
+			if tt.source {
+				m.SetNonceSource(func(string) uint64 { return tt.current })
+			}
+			for _, n := range tt.pooled {
+				if err := m.Push(poolTx("a", n, 1)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := nonces(m.Pending()["a"]); fmt.Sprint(got) != fmt.Sprint(tt.pending) {
+				t.Errorf("pending %v, want %v", got, tt.pending)
+			}
+			if got := nonces(m.Queued()["a"]); fmt.Sprint(got) != fmt.Sprint(tt.queued) {
+				t.Errorf("queued %v, want %v", got, tt.queued)
+			}
+			want := tt.current + 1
+			if !tt.source {
+				want = 1
+			}
+			if len(tt.pending) > 0 {
+				want = tt.pending[len(tt.pending)-1] + 1
+			}
+			if got := m.PendingNonce("a"); got != want {
+				t.Errorf("pending nonce %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	m := NewMempoolWithConfig(MempoolConfig{TTL: time.Hour})
+	m.SetNonceSource(func(string) uint64 { return 0 })
+	for _, tx := range []Transaction{poolTx("a", 1, 1), poolTx("a", 2, 1), poolTx("b", 1, 1)} {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a's first has waited too long; a's second becomes queued behind it
+	old := poolTx("a", 1, 1)
+	m.all[old.ID()].added = time.Now().Add(-2 * time.Hour)
+	m.Expire()
+	if m.Len() != 2 || len(m.Pending()["a"]) != 0 || len(m.Queued()["a"]) != 1 {
+		t.Fatalf("after expiry: %d pooled, pending %v, queued %v", m.Len(), m.Pending(), m.Queued())
+	}
+
+	// pushing expires too
+	b := poolTx("b", 1, 1)
+	m.all[b.ID()].added = time.Now().Add(-2 * time.Hour)
+	if err := m.Push(poolTx("c", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Pending()["b"]; ok || m.Len() != 2 {
+		t.Fatalf("b not expired on push: %v", m.Pending())
+	}
+}
+
+func TestAccountLimit(t *testing.T) {
+	m := NewMempoolWithConfig(MempoolConfig{MaxPerAccount: 2, PriceBump: 10})
+	for _, tx := range []Transaction{poolTx("a", 1, 1), poolTx("a", 2, 1), poolTx("b", 1, 1)} {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Push(poolTx("a", 3, 1)); !errors.Is(err, ErrAccountMempoolLimit) {
+		t.Errorf("third from a: got %v, want %v", err, ErrAccountMempoolLimit)
+	}
+	// a replacement does not add to the sender's count
+	if err := m.Push(poolTx("a", 2, 2)); err != nil {
+		t.Errorf("replacement at the limit: %v", err)
+	}
+	if m.Len() != 3 {
+		t.Errorf("%d pooled, want 3", m.Len())
+	}
+}
+
+func TestPoolFullEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		pooled  []Transaction
+		push    Transaction
+		want    error
+		evicted string // "" if nothing is
+	}{
+		{
+			name:   "cheaper than every tail",
+			pooled: []Transaction{poolTx("a", 1, 5), poolTx("a", 2, 2), poolTx("b", 1, 3)},
+			push:   poolTx("c", 1, 1),
+			want:   ErrMempoolFull,
+		},
+		{
+			name:   "same price as cheapest tail",
+			pooled: []Transaction{poolTx("a", 1, 5), poolTx("a", 2, 2), poolTx("b", 1, 3)},
+			push:   poolTx("c", 1, 2),
+			want:   ErrMempoolFull,
+		},
+		{
+			name:    "evicts cheapest tail",
+			pooled:  []Transaction{poolTx("a", 1, 5), poolTx("a", 2, 2), poolTx("b", 1, 3)},
+			push:    poolTx("c", 1, 4),
+			evicted: "a2",
+		},
+		{
+			name:    "never evicts from inside a queue",
+			pooled:  []Transaction{poolTx("a", 1, 1), poolTx("a", 2, 9), poolTx("b", 1, 5)},
+			push:    poolTx("c", 1, 6),
+			evicted: "b1",
+		},
+		{
+			name:    "newest on equal prices",
+			pooled:  []Transaction{poolTx("a", 1, 2), poolTx("b", 1, 2), poolTx("c", 1, 2)},
+			push:    poolTx("d", 1, 3),
+			evicted: "c1",
+		},
+		{
+			name:    "sender's own tail",
+			pooled:  []Transaction{poolTx("a", 1, 5), poolTx("a", 2, 1), poolTx("b", 1, 3)},
+			push:    poolTx("a", 3, 2),
+			evicted: "a2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMempoolWithConfig(MempoolConfig{MaxTxs: 3})
+			for _, tx := range tt.pooled {
+				if err := m.Push(tx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := m.Push(tt.push); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if m.Len() != 3 {
+				t.Errorf("%d pooled, want 3", m.Len())
+			}
+			for _, tx := range tt.pooled {
+				name := fmt.Sprintf("%s%d", tx.From, tx.Nonce)
+				if _, ok := m.all[tx.ID()]; ok == (name == tt.evicted) {
+					t.Errorf("%s pooled: %v", name, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestReplacementThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		bump     int
+		old, new Transaction
+		want     error
+	}{
+		{"same price", 10, poolTx("a", 1, 10), poolTx("a", 1, 10), ErrAlreadyKnown},
+		{"below bump", 10, poolTx("a", 1, 100), poolTx("a", 1, 109), ErrReplaceUnderpriced},
+		{"exactly bump", 10, poolTx("a", 1, 100), poolTx("a", 1, 110), nil},
+		{"rounds up", 10, poolTx("a", 1, 10), poolTx("a", 1, 11), nil},
+		{"lower price", 10, poolTx("a", 1, 10), poolTx("a", 1, 5), ErrReplaceUnderpriced},
+		{"no bump still needs more", 0, poolTx("a", 1, 10), poolTx("a", 1, 10), ErrAlreadyKnown},
+		{"no bump", 0, poolTx("a", 1, 10), poolTx("a", 1, 11), nil},
+		{"bigger gas limit alone", 10, poolTx("a", 1, 10), func() Transaction {
+			tx := poolTx("a", 1, 10)
+			tx.GasLimit, tx.Signature = 1000, "more gas"
+			return tx
+		}(), ErrReplaceUnderpriced},
+		{"same price new payload", 10, poolTx("a", 1, 10), func() Transaction {
+			tx := poolTx("a", 1, 10)
+			tx.Amount, tx.Signature = 2, "other"
+			return tx
+		}(), ErrReplaceUnderpriced},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMempoolWithConfig(MempoolConfig{PriceBump: tt.bump})
+			if err := m.Push(tt.old); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Push(tt.new); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			want := tt.old
+			if tt.want == nil {
+				want = tt.new
+			}
+			if got := m.PendingTransactions(); len(got) != 1 || got[0].ID() != want.ID() {
+				t.Errorf("pooled %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExpireBoundary(t *testing.T) {
+	const ttl = time.Hour
+	m := NewMempoolWithConfig(MempoolConfig{TTL: ttl})
+	tx := poolTx("a", 1, 1)
+	if err := m.Push(tx); err != nil {
+		t.Fatal(err)
+	}
+	added := m.all[tx.ID()].added
+	m.expire(added.Add(ttl))
+	if m.Len() != 1 {
+		t.Fatal("expired after exactly the TTL")
+	}
+	m.expire(added.Add(ttl + time.Nanosecond))
+	if m.Len() != 0 {
+		t.Fatal("kept past the TTL")
+	}
+
+	// no TTL keeps transactions indefinitely
+	m = NewMempoolWithConfig(MempoolConfig{})
+	if err := m.Push(tx); err != nil {
+		t.Fatal(err)
+	}
+	m.expire(time.Now().Add(1000 * time.Hour))
+	if m.Len() != 1 {
+		t.Fatal("expired without a TTL")
+	}
+}
+
+func TestReorgReturnsTransactions(t *testing.T) {
+	m := NewMempool()
+	// the new branch used a's first nonce
+	m.SetNonceSource(func(addr string) uint64 {
+		if addr == "a" {
+			return 1
+		}
+		return 0
+	})
+	path := filepath.Join(t.TempDir(), "journal")
+	if err := m.OpenJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	defer m.CloseJournal()
+	notified := 0
+	m.Subscribe(func(Transaction) { notified++ })
+
+	a1, a2, b1 := poolTx("a", 1, 1), poolTx("a", 2, 1), poolTx("b", 1, 1)
+	m.HandleChainEvent(ChainEvent{
+		Removed: []Block{{Transactions: []Transaction{a1, a2, b1}}},
+		Added:   []Block{{Transactions: []Transaction{a1}}},
+	})
+	if got := m.Pending(); len(got["a"]) != 1 || got["a"][0].ID() != a2.ID() || len(got["b"]) != 1 {
+		t.Errorf("pending %v, want a2 and b1", got)
+	}
+	if _, ok := m.all[a1.ID()]; ok {
+		t.Error("tx included on the new branch returned to the pool")
+	}
+	if notified != 0 {
+		t.Errorf("%d subscriber calls, want none", notified)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Errorf("journal written: %v, %v", fi.Size(), err)
+	}
+}
+
+func TestRevalidateUnlocked(t *testing.T) {
+	m := NewMempool()
+	a1, a2, a3 := poolTx("a", 1, 1), poolTx("a", 2, 1), poolTx("a", 3, 1)
+	for _, tx := range []Transaction{a1, a2, a3} {
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a validator that reads the pool, as one going through the chain may
+	m.SetValidator(func(txs []Transaction) []RejectedTx {
+		m.ClearMined([]Transaction{a1})
+		return []RejectedTx{{Tx: a2, Err: ErrInsufficientFunds}, {Tx: a3, Err: ErrNonceGap}}
+	})
+	done := make(chan struct{})
+	var dropped, demoted []RejectedTx
+	go func() {
+		dropped, demoted = m.Revalidate()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Revalidate holds the pool lock while validating")
+	}
+	if len(dropped) != 1 || dropped[0].Tx.ID() != a2.ID() {
+		t.Errorf("dropped %v, want a2", dropped)
+	}
+	if len(demoted) != 1 || demoted[0].Tx.ID() != a3.ID() {
+		t.Errorf("demoted %v, want a3", demoted)
+	}
+	if m.Len() != 1 {
+		t.Errorf("%d pooled, want a3 alone", m.Len())
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var ErrTxNotFound = errors.New("transaction not found")
+
+// ProofStep is one sibling hash on the path from a leaf to the Merkle root.
+type ProofStep struct {
+	Hash string `json:"hash"`
+	Left bool   `json:"left"` // sibling sits to the left of the running hash
+}
+
+// Leaves and inner nodes are domain-separated so an inner node can never be
+// passed off as a leaf.
+func merkleLeaf(id string) []byte {
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		raw = []byte(id)
+	}
+	h := sha256.Sum256(append([]byte{0x00}, raw...))
+	return h[:]
+}
+
+func merkleNode(l, r []byte) []byte {
+	buf := make([]byte, 0, 1+len(l)+len(r))
+	buf = append(buf, 0x01)
+	buf = append(buf, l...)
+	buf = append(buf, r...)
+	h := sha256.Sum256(buf)
+	return h[:]
+}
+
+// MerkleRoot returns the root over ids. An odd node at the end of a level is
+// carried up unchanged rather than duplicated.
+func MerkleRoot(ids []string) string {
+	if len(ids) == 0 {
+		h := sha256.Sum256(nil)
+		return hex.EncodeToString(h[:])
+	}
+	level := make([][]byte, len(ids))
+	for i, id := range ids {
+		level[i] = merkleLeaf(id)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
+
+// MerkleProof returns the inclusion proof for ids[index].
+func MerkleProof(ids []string, index int) ([]ProofStep, error) {
+	if index < 0 || index >= len(ids) {
+		return nil, fmt.Errorf("index %d out of range", index)
+	}
+	level := make([][]byte, len(ids))
+	for i, id := range ids {
+		level[i] = merkleLeaf(id)
+	}
+	var proof []ProofStep
+	for len(level) > 1 {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, ProofStep{Hash: hex.EncodeToString(level[sibling]), Left: sibling < index})
+		}
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		level = next
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof checks that id is included under root.
+func VerifyMerkleProof(id string, proof []ProofStep, root string) bool {
+	h := merkleLeaf(id)
+	for _, step := range proof {
+		sib, err := hex.DecodeString(step.Hash)
+		if err != nil {
+			return false
+		}
+		if step.Left {
+			h = merkleNode(sib, h)
+		} else {
+			h = merkleNode(h, sib)
+		}
+	}
+	return hex.EncodeToString(h) == root
+}
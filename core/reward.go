@@ -0,0 +1,43 @@
+package core
+
+import "github.com/ethereum/go-ethereum/common"
+
+// RewardConfig sets the subsidy minted to the coinbase of every block. The
+// coinbase also collects the block's transaction fees.
+type RewardConfig struct {
+	Subsidy         int    `json:"subsidy"`         // reward per block before any halving
+	HalvingInterval uint64 `json:"halvingInterval"` // blocks between halvings; 0 never halves
+}
+
+func DefaultRewardConfig() RewardConfig {
+	return RewardConfig{Subsidy: 50, HalvingInterval: 100000}
+}
+
+// BlockSubsidy returns the reward minted for the block at height number: the
+// initial subsidy halved once per completed interval.
+func (r RewardConfig) BlockSubsidy(number uint64) int {
+	if r.HalvingInterval == 0 {
+		return r.Subsidy
+	}
+	halvings := number / r.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return r.Subsidy >> halvings
+}
+
+func validCoinbase(addr string) bool {
+	return addr == "" || common.IsHexAddress(addr)
+}
+
+// reward credits the block subsidy and the fees collected so far to
+// coinbase. A block without a coinbase mints nothing and its fees are burnt.
+func (s *stateOverlay) reward(coinbase string) {
+	if coinbase == "" {
+		return
+	}
+	amount := s.chain.rewardConfig().BlockSubsidy(s.number) + s.fees
+	if amount != 0 {
+		s.balances[coinbase] = s.balance(coinbase) + amount
+	}
+}
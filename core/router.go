@@ -0,0 +1,121 @@
+package core
+
+import "fmt"
+
+// State is the view of the chain state a transaction handler works on.
+// Writes are buffered with the rest of the block and only reach the chain
+// if the block is accepted.
+type State interface {
+	Height() uint64 // of the block being applied
+	Balance(addr string) int
+	SetBalance(addr string, bal int)
+	Stake(addr string) int
+	Bond(addr string, amount int)
+	Unbond(addr string, amount int)
+	// Store returns the module key-value store under namespace, usually the
+	// module's name.
+	Store(namespace string) *Store
+}
+
+// TxHandler executes the transactions routed to it by type. The chain checks
+// and advances the sender's nonce and charges the fee itself; the state a
+// handler sees has the fee already deducted.
+type TxHandler interface {
+	// CheckTx reports whether tx can be applied to s. It must not write to s.
+	CheckTx(s State, tx *Transaction) error
+	// ExecTx applies tx to s. It runs only after CheckTx passed.
+	ExecTx(s State, tx *Transaction)
+}
+
+// TxRouter finds the handler for a transaction type.
+type TxRouter interface {
+	Route(txType string) (TxHandler, bool)
+}
+
+// NativeRouter routes the built-in transaction types, transfers and staking.
+// It is the chain's router unless SetRouter installs another.
+type NativeRouter struct{}
+
+func (NativeRouter) Route(txType string) (TxHandler, bool) {
+	switch txType {
+	case TxTransfer:
+		return TransferHandler{}, true
+	case TxBond, TxUnbond:
+		return StakingHandler{}, true
+	}
+	return nil, false
+}
+
+// TransferHandler moves Amount from the sender's balance to the recipient's.
+type TransferHandler struct{}
+
+func (TransferHandler) CheckTx(s State, tx *Transaction) error {
+	if tx.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if bal := s.Balance(tx.From); bal < tx.Amount {
+		return fmt.Errorf("%w: have %d after fee, need %d", ErrInsufficientFunds, bal, tx.Amount)
+	}
+	return nil
+}
+
+func (TransferHandler) ExecTx(s State, tx *Transaction) {
+	s.SetBalance(tx.From, s.Balance(tx.From)-tx.Amount)
+	s.SetBalance(tx.To, s.Balance(tx.To)+tx.Amount)
+}
+
+// StakingHandler bonds Amount of the sender's balance or unbonds Amount of
+// its stake.
+type StakingHandler struct{}
+
+func (StakingHandler) CheckTx(s State, tx *Transaction) error {
+	if tx.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	switch tx.Type {
+	case TxBond:
+		return TransferHandler{}.CheckTx(s, tx)
+	case TxUnbond:
+		if stake := s.Stake(tx.From); stake < tx.Amount {
+			return fmt.Errorf("%w: have %d, need %d", ErrInsufficientStake, stake, tx.Amount)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownTxType, tx.Type)
+}
+
+func (StakingHandler) ExecTx(s State, tx *Transaction) {
+	switch tx.Type {
+	case TxBond:
+		s.SetBalance(tx.From, s.Balance(tx.From)-tx.Amount)
+		s.Bond(tx.From, tx.Amount)
+	case TxUnbond:
+		s.Unbond(tx.From, tx.Amount)
+	}
+}
+
+// SetRouter installs the router that dispatches transactions to their
+// handlers and rebuilds the state with its hooks, starting with its genesis
+// hook. It should be called before blocks are restored or added.
+func (c *Chain) SetRouter(r TxRouter) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.router = r
+	return c.rebuild()
+}
+
+func (c *Chain) route(txType string) (TxHandler, bool) {
+	if c.router == nil {
+		return NativeRouter{}.Route(txType)
+	}
+	return c.router.Route(txType)
+}
+
+// The overlay is the State handlers see.
+
+func (s *stateOverlay) Height() uint64                  { return s.number }
+func (s *stateOverlay) Balance(addr string) int         { return s.balance(addr) }
+func (s *stateOverlay) SetBalance(addr string, bal int) { s.balances[addr] = bal }
+func (s *stateOverlay) Stake(addr string) int           { return s.staking.Stakes[NormalizeAddress(addr)] }
+func (s *stateOverlay) Bond(addr string, amount int)    { s.bond(addr, amount) }
+func (s *stateOverlay) Unbond(addr string, amount int)  { s.unbond(addr, amount) }
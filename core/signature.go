@@ -0,0 +1,100 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// txDomain prefixes every transaction signing payload so a transaction
+// signature cannot be passed off as a signature over anything else.
+const txDomain = "modular-blockchain-framework/tx/v1"
+
+// SigningMessage is the canonical payload a wallet signs for tx: the domain,
+// chain ID, from, to, amount, type, nonce, gas limit, gas price and data,
+// with strings length-prefixed and integers as big-endian uint64s. Data is
+// left out when empty, so transactions without it sign as they always have.
+// The chain ID keeps a signature from being replayed on another network.
+func (tx *Transaction) SigningMessage() []byte {
+	var buf bytes.Buffer
+	writeString(&buf, txDomain)
+	writeUint64(&buf, tx.ChainID)
+	writeString(&buf, tx.From)
+	writeString(&buf, tx.To)
+	writeUint64(&buf, uint64(tx.Amount))
+	writeString(&buf, tx.Type)
+	writeUint64(&buf, tx.Nonce)
+	writeUint64(&buf, tx.GasLimit)
+	writeUint64(&buf, uint64(tx.GasPrice))
+	if tx.Data != "" {
+		writeString(&buf, tx.Data)
+	}
+	return buf.Bytes()
+}
+
+// SigningHash is the hash a wallet signs for tx.
+func (tx *Transaction) SigningHash() []byte {
+	return crypto.Keccak256(tx.SigningMessage())
+}
+
+// VerifySignature reports whether sigHex is a signature of keccak256(message)
+// by address.
+func VerifySignature(address string, message []byte, sigHex string) (bool, error) {
+	recoveredAddr, err := RecoverAddress(crypto.Keccak256(message), sigHex)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(recoveredAddr, address), nil
+}
+
+// RecoverAddress returns the checksummed address that produced sigHex over hash.
+func RecoverAddress(hash []byte, sigHex string) (string, error) {
+	sig, err := hexutil.Decode(sigHex)
+	if err != nil {
+		return "", err
+	}
+	pubKey, err := crypto.Ecrecover(hash, sig)
+	if err != nil {
+		return "", err
+	}
+	pk, err := crypto.UnmarshalPubkey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return crypto.PubkeyToAddress(*pk).Hex(), nil
+}
+
+// Sender recovers the address that signed tx.
+func (tx *Transaction) Sender() (string, error) {
+	if tx.Signature == "" {
+		return "", ErrMissingSignature
+	}
+	addr, err := RecoverAddress(tx.SigningHash(), tx.Signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return addr, nil
+}
+
+// Verify performs the checks on tx that need no chain state: an amount that
+// is not negative, enough gas and a signature by tx.From. Handlers that move
+// funds require a positive amount themselves.
+func (tx *Transaction) Verify() error {
+	if tx.Amount < 0 {
+		return ErrInvalidAmount
+	}
+	if err := validateGas(tx); err != nil {
+		return err
+	}
+	sender, err := tx.Sender()
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sender, tx.From) {
+		return fmt.Errorf("%w: signed by %s", ErrInvalidSignature, sender)
+	}
+	return nil
+}
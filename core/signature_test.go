@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// signingVector pins the signing payload of a transaction. The dashboard
+// checks its signTransaction against the same file.
+type signingVector struct {
+	Name      string
+	Tx        Transaction // keys as the dashboard sends them
+	Message   string
+	Hash      string
+	Signature string // by DevFaucetKey
+	ID        string
+}
+
+func loadSigningVectors(t *testing.T) []signingVector {
+	t.Helper()
+	data, err := os.ReadFile("testdata/signing_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []signingVector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+func TestSigningVectors(t *testing.T) {
+	key, err := crypto.HexToECDSA(DevFaucetKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range loadSigningVectors(t) {
+		t.Run(v.Name, func(t *testing.T) {
+			if got := hexutil.Encode(v.Tx.SigningMessage()); got != v.Message {
+				t.Errorf("message %s, want %s", got, v.Message)
+			}
+			if got := hexutil.Encode(v.Tx.SigningHash()); got != v.Hash {
+				t.Errorf("hash %s, want %s", got, v.Hash)
+			}
+			sig, err := crypto.Sign(v.Tx.SigningHash(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hexutil.Encode(sig); got != v.Signature {
+				t.Errorf("signature %s, want %s", got, v.Signature)
+			}
+			v.Tx.Signature = v.Signature
+			if err := v.Tx.Verify(); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+			if got := v.Tx.ID(); got != v.ID {
+				t.Errorf("id %s, want %s", got, v.ID)
+			}
+		})
+	}
+}
+
+func TestWrongChainID(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+
+	other := a.transfer(t, 1, 1, 1)
+	other.ChainID = DefaultChainID + 1
+	a.sign(t, &other)
+	if err := c.CheckTx(&other); !errors.Is(err, ErrWrongChainID) {
+		t.Errorf("signed for another chain: got %v, want %v", err, ErrWrongChainID)
+	}
+
+	// a transaction replayed with its chain ID rewritten no longer verifies
+	replayed := a.transfer(t, 1, 1, 1)
+	replayed.ChainID = DefaultChainID + 1
+	g := DefaultGenesis()
+	g.ChainID = DefaultChainID + 1
+	g.Alloc[a.addr] = 1000
+	if err := NewChainWithGenesis(g).CheckTx(&replayed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("replayed on another chain: got %v, want %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,217 @@
+package core
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Transaction types. The zero value is a plain transfer.
+const (
+	TxTransfer = ""
+	TxBond     = "bond"   // moves Amount from the sender's balance into its stake
+	TxUnbond   = "unbond" // starts returning Amount of stake after the unbonding period
+)
+
+var (
+	ErrUnknownTxType       = errors.New("unknown transaction type")
+	ErrInsufficientStake   = errors.New("insufficient bonded stake")
+	ErrInvalidEvidence     = errors.New("invalid double-sign evidence")
+	ErrStaleEvidence       = errors.New("evidence is older than the unbonding period")
+	ErrDuplicateEvidence   = errors.New("offence already slashed")
+	ErrInvalidEvidenceRoot = errors.New("evidence root mismatch")
+)
+
+// StakingConfig holds the staking parameters fixed at genesis.
+type StakingConfig struct {
+	UnbondingPeriod uint64         `json:"unbondingPeriod"` // blocks before unbonded stake is returned
+	SlashPercent    int            `json:"slashPercent"`    // share of stake burned per double-sign
+	Stakes          map[string]int `json:"stakes"`          // stake bonded at genesis
+}
+
+func DefaultStakingConfig() StakingConfig {
+	return StakingConfig{UnbondingPeriod: 10, SlashPercent: 50}
+}
+
+// Unbonding is stake waiting out the unbonding period. It can still be
+// slashed until it is released back to the balance.
+type Unbonding struct {
+	Address       string `json:"address"`
+	Amount        int    `json:"amount"`
+	ReleaseHeight uint64 `json:"releaseHeight"`
+}
+
+// StakingState is the staking ledger as of a block. Every block in the tree
+// keeps its own, so engines can read the stake distribution of any branch.
+// A ledger reached through the chain must not be modified.
+type StakingState struct {
+	Stakes    map[string]int  `json:"stakes"`    // bonded stake by checksummed address
+	Unbonding []Unbonding     `json:"unbonding"` // in release order
+	Slashed   map[string]bool `json:"slashed"`   // punished offences, see offenceKey
+}
+
+func newStakingState(stakes map[string]int) *StakingState {
+	s := &StakingState{Stakes: make(map[string]int), Slashed: make(map[string]bool)}
+	for addr, amount := range stakes {
+		if amount > 0 {
+			s.Stakes[NormalizeAddress(addr)] += amount
+		}
+	}
+	return s
+}
+
+func (s *StakingState) copy() *StakingState {
+	cp := &StakingState{
+		Stakes:    make(map[string]int, len(s.Stakes)),
+		Unbonding: append([]Unbonding(nil), s.Unbonding...),
+		Slashed:   make(map[string]bool, len(s.Slashed)),
+	}
+	for addr, amount := range s.Stakes {
+		cp.Stakes[addr] = amount
+	}
+	for key := range s.Slashed {
+		cp.Slashed[key] = true
+	}
+	return cp
+}
+
+// TotalStake is the sum of all bonded stake.
+func (s *StakingState) TotalStake() int {
+	total := 0
+	for _, amount := range s.Stakes {
+		total += amount
+	}
+	return total
+}
+
+// NormalizeAddress returns addr in the checksummed form the chain keys
+// stakes, validators and module state by.
+func NormalizeAddress(addr string) string { return common.HexToAddress(addr).Hex() }
+
+func offenceKey(addr string, height uint64) string { return fmt.Sprintf("%s/%d", addr, height) }
+
+// Evidence proves that a validator signed two different headers for the same
+// slot: same height, parent and timestamp.
+type Evidence struct {
+	A Header `json:"a"`
+	B Header `json:"b"`
+}
+
+// ID identifies the pair of headers regardless of their order.
+func (e *Evidence) ID() string {
+	a, b := e.A.ComputeHash(), e.B.ComputeHash()
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(a+b)))
+}
+
+// Offender checks the evidence and returns the address that signed both headers.
+func (e *Evidence) Offender() (string, error) {
+	if e.A.Number != e.B.Number || e.A.PrevHash != e.B.PrevHash || e.A.Timestamp != e.B.Timestamp {
+		return "", fmt.Errorf("%w: headers are for different slots", ErrInvalidEvidence)
+	}
+	if string(e.A.SigningHash()) == string(e.B.SigningHash()) {
+		return "", fmt.Errorf("%w: headers are identical", ErrInvalidEvidence)
+	}
+	a, err := RecoverAddress(e.A.SigningHash(), e.A.Signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	b, err := RecoverAddress(e.B.SigningHash(), e.B.Signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	if a != b {
+		return "", fmt.Errorf("%w: signed by %s and %s", ErrInvalidEvidence, a, b)
+	}
+	return a, nil
+}
+
+// EvidenceIDs returns the IDs of the block's evidence in order.
+func (b *Block) EvidenceIDs() []string {
+	ids := make([]string, len(b.Evidence))
+	for i := range b.Evidence {
+		ids[i] = b.Evidence[i].ID()
+	}
+	return ids
+}
+
+// releaseUnbonded returns stake whose unbonding period ends at this block.
+func (s *stateOverlay) releaseUnbonded() {
+	kept := s.staking.Unbonding[:0]
+	for _, u := range s.staking.Unbonding {
+		if u.ReleaseHeight > s.number {
+			kept = append(kept, u)
+			continue
+		}
+		s.balances[u.Address] = s.balance(u.Address) + u.Amount
+	}
+	s.staking.Unbonding = kept
+}
+
+// applyEvidence burns SlashPercent of the offender's bonded and unbonding stake.
+func (s *stateOverlay) applyEvidence(ev *Evidence) error {
+	offender, err := ev.Offender()
+	if err != nil {
+		return err
+	}
+	cfg := s.chain.stakingConfig()
+	height := ev.A.Number
+	if height >= s.number {
+		return fmt.Errorf("%w: offence at %d is not before block %d", ErrInvalidEvidence, height, s.number)
+	}
+	if height+cfg.UnbondingPeriod < s.number {
+		return fmt.Errorf("%w: offence at %d", ErrStaleEvidence, height)
+	}
+	key := offenceKey(offender, height)
+	if s.staking.Slashed[key] {
+		return fmt.Errorf("%w: %s", ErrDuplicateEvidence, key)
+	}
+	held := s.staking.Stakes[offender]
+	for _, u := range s.staking.Unbonding {
+		if NormalizeAddress(u.Address) == offender {
+			held += u.Amount
+		}
+	}
+	if held == 0 {
+		return fmt.Errorf("%w: %s has no stake", ErrInvalidEvidence, offender)
+	}
+	slash := func(amount int) int { return amount - amount*cfg.SlashPercent/100 }
+	if stake := slash(s.staking.Stakes[offender]); stake > 0 {
+		s.staking.Stakes[offender] = stake
+	} else {
+		delete(s.staking.Stakes, offender)
+	}
+	for i := range s.staking.Unbonding {
+		if NormalizeAddress(s.staking.Unbonding[i].Address) == offender {
+			s.staking.Unbonding[i].Amount = slash(s.staking.Unbonding[i].Amount)
+		}
+	}
+	s.staking.Slashed[key] = true
+	return nil
+}
+
+func (s *stateOverlay) bond(addr string, amount int) {
+	s.staking.Stakes[NormalizeAddress(addr)] += amount
+}
+
+// unbond queues up to amount of addr's stake for release. The released funds
+// are credited to addr exactly as spelled, like the balance bond debited.
+func (s *stateOverlay) unbond(addr string, amount int) {
+	key := NormalizeAddress(addr)
+	amount = min(amount, s.staking.Stakes[key])
+	if amount <= 0 {
+		return
+	}
+	if s.staking.Stakes[key] -= amount; s.staking.Stakes[key] == 0 {
+		delete(s.staking.Stakes, key)
+	}
+	s.staking.Unbonding = append(s.staking.Unbonding, Unbonding{
+		Address:       addr,
+		Amount:        amount,
+		ReleaseHeight: s.number + s.chain.stakingConfig().UnbondingPeriod,
+	})
+}
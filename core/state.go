@@ -0,0 +1,303 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ComputeStateRoot returns the root of the state trie holding every
+// account's balance and nonce, the staking ledger and the module stores.
+// Accounts with neither balance nor nonce are absent so an explicit zero
+// does not change it.
+func ComputeStateRoot(balances map[string]int, nonces map[string]uint64, staking *StakingState, kv map[string][]byte) string {
+	var t *trieNode
+	for addr, bal := range balances {
+		t = t.setAccount(addr, bal, nonces[addr])
+	}
+	for addr, nonce := range nonces {
+		if _, ok := balances[addr]; !ok {
+			t = t.setAccount(addr, 0, nonce)
+		}
+	}
+	for key, v := range kv {
+		t = t.setStore(key, v)
+	}
+	return t.setStaking(staking).root()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stateOverlay buffers balance, nonce and store writes on top of the chain
+// state so a block can be checked without mutating the chain. The staking
+// ledger is copied from the parent block and becomes the new block's ledger.
+// Overlays stack: a child layer reads through to its parent and reaches it
+// only through flush, so a failing transaction or hook leaves no writes.
+type stateOverlay struct {
+	chain    *Chain
+	parent   *stateOverlay // nil for the block's own layer
+	number   uint64        // height of the block being applied
+	balances map[string]int
+	nonces   map[string]uint64
+	kv       map[string][]byte // nil values are deletions
+	staking  *StakingState
+	fees     int // collected from the block's transactions for the coinbase
+}
+
+// newStateOverlay starts a block on top of parent. Balances and nonces are
+// read from the chain state, so they are only meaningful when parent is the head.
+func (c *Chain) newStateOverlay(parent *blockNode) *stateOverlay {
+	return &stateOverlay{
+		chain:    c,
+		number:   parent.block.Number + 1,
+		balances: make(map[string]int),
+		nonces:   make(map[string]uint64),
+		kv:       make(map[string][]byte),
+		staking:  parent.staking.copy(),
+	}
+}
+
+// child starts a cache layer on top of s.
+func (s *stateOverlay) child() *stateOverlay {
+	return &stateOverlay{
+		chain:    s.chain,
+		parent:   s,
+		number:   s.number,
+		balances: make(map[string]int),
+		nonces:   make(map[string]uint64),
+		kv:       make(map[string][]byte),
+		staking:  s.staking.copy(),
+	}
+}
+
+// flush writes the layer's changes into its parent.
+func (s *stateOverlay) flush() {
+	p := s.parent
+	for addr, bal := range s.balances {
+		p.balances[addr] = bal
+	}
+	for addr, n := range s.nonces {
+		p.nonces[addr] = n
+	}
+	for key, v := range s.kv {
+		p.kv[key] = v
+	}
+	p.staking = s.staking
+	p.fees += s.fees
+}
+
+func (s *stateOverlay) balance(addr string) int {
+	for l := s; l != nil; l = l.parent {
+		if bal, ok := l.balances[addr]; ok {
+			return bal
+		}
+	}
+	return s.chain.State[addr]
+}
+
+func (s *stateOverlay) nonce(addr string) uint64 {
+	for l := s; l != nil; l = l.parent {
+		if n, ok := l.nonces[addr]; ok {
+			return n
+		}
+	}
+	return s.chain.Nonces[addr]
+}
+
+// applyTx checks tx against the overlay state and applies it: the chain's
+// own checks that tx.Nonce is exactly the sender's next and that it pays its
+// fee, then those of the handler for its type. A transaction that fails
+// leaves the overlay unchanged.
+func (s *stateOverlay) applyTx(tx *Transaction) error {
+	switch cur := s.nonce(tx.From); {
+	case tx.Nonce <= cur:
+		return fmt.Errorf("%w: got %d, expected %d", ErrInvalidNonce, tx.Nonce, cur+1)
+	case tx.Nonce > cur+1:
+		return fmt.Errorf("%w: got %d, expected %d", ErrNonceGap, tx.Nonce, cur+1)
+	}
+	if minPrice := s.chain.gasConfig().MinGasPrice; tx.GasPrice < minPrice {
+		return fmt.Errorf("%w: %d < %d", ErrGasPriceTooLow, tx.GasPrice, minPrice)
+	}
+	h, ok := s.chain.route(tx.Type)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTxType, tx.Type)
+	}
+	if bal, fee := s.balance(tx.From), tx.Fee(); bal < fee {
+		return fmt.Errorf("%w: have %d, need fee %d", ErrInsufficientFunds, bal, fee)
+	}
+	txState := s.child()
+	txState.chargeFee(tx)
+	if err := h.CheckTx(txState, tx); err != nil {
+		return err
+	}
+	h.ExecTx(txState, tx)
+	txState.advanceNonce(tx)
+	txState.flush()
+	return nil
+}
+
+func (s *stateOverlay) chargeFee(tx *Transaction) {
+	if fee := tx.Fee(); fee != 0 {
+		s.balances[tx.From] = s.balance(tx.From) - fee
+		s.fees += fee
+	}
+}
+
+func (s *stateOverlay) advanceNonce(tx *Transaction) {
+	if tx.Nonce > s.nonce(tx.From) {
+		s.nonces[tx.From] = tx.Nonce
+	}
+}
+
+// applyBlock releases matured unbonding stake, slashes for the block's
+// evidence, runs the begin block hook, applies its transactions, failing on
+// the first invalid one, runs the end block hook and pays the coinbase.
+func (s *stateOverlay) applyBlock(b *Block) error {
+	s.releaseUnbonded()
+	for i := range b.Evidence {
+		if err := s.applyEvidence(&b.Evidence[i]); err != nil {
+			return fmt.Errorf("evidence %d (%s): %w", i, b.Evidence[i].ID(), err)
+		}
+	}
+	if err := s.beginBlock(&b.Header); err != nil {
+		return err
+	}
+	for i := range b.Transactions {
+		if err := s.applyTx(&b.Transactions[i]); err != nil {
+			return &TxError{Index: i, ID: b.Transactions[i].ID(), Err: err}
+		}
+	}
+	if err := s.endBlock(&b.Header); err != nil {
+		return err
+	}
+	s.reward(b.Coinbase)
+	return nil
+}
+
+// trie returns the chain's state trie with the overlay's changes applied. It
+// is only meaningful on the block's own layer.
+func (s *stateOverlay) trie() *trieNode {
+	t := s.chain.trie
+	for addr := range s.balances {
+		t = t.setAccount(addr, s.balance(addr), s.nonce(addr))
+	}
+	for addr := range s.nonces {
+		if _, ok := s.balances[addr]; !ok {
+			t = t.setAccount(addr, s.balance(addr), s.nonce(addr))
+		}
+	}
+	for key, v := range s.kv {
+		t = t.setStore(key, v)
+	}
+	return t.setStaking(s.staking)
+}
+
+// root returns the state root the chain would have after commit.
+func (s *stateOverlay) root() string {
+	return s.trie().root()
+}
+
+// commit writes the buffered changes into the chain state and its trie and
+// returns the undo record that reverts them.
+func (s *stateOverlay) commit() *stateUndo {
+	s.chain.trie = s.trie()
+	undo := &stateUndo{
+		balances: make(map[string]int, len(s.balances)),
+		nonces:   make(map[string]priorNonce, len(s.nonces)),
+		kv:       make(map[string][]byte, len(s.kv)),
+	}
+	for addr, bal := range s.balances {
+		undo.balances[addr] = s.chain.State[addr]
+		s.chain.State[addr] = bal
+	}
+	for addr, n := range s.nonces {
+		prev, ok := s.chain.Nonces[addr]
+		undo.nonces[addr] = priorNonce{value: prev, existed: ok}
+		s.chain.Nonces[addr] = n
+	}
+	for key, v := range s.kv {
+		undo.kv[key] = s.chain.kv[key]
+		setKV(s.chain.kv, key, v)
+	}
+	return undo
+}
+
+type priorNonce struct {
+	value   uint64
+	existed bool
+}
+
+// stateUndo records what a block changed so a reorg can roll it back. The
+// staking ledger needs no undo since every block keeps its own. The trie
+// leaves a block touched are recomputed from the reverted maps.
+type stateUndo struct {
+	balances map[string]int // prior values
+	nonces   map[string]priorNonce
+	kv       map[string][]byte // prior values, nil if absent
+}
+
+// redo captures the current values of everything the head block n changed,
+// before it is reverted.
+func (u *stateUndo) redo(c *Chain, n *blockNode) *stateOverlay {
+	s := &stateOverlay{
+		chain:    c,
+		number:   n.block.Number,
+		balances: make(map[string]int, len(u.balances)),
+		nonces:   make(map[string]uint64, len(u.nonces)),
+		kv:       make(map[string][]byte, len(u.kv)),
+		staking:  n.staking,
+	}
+	for addr := range u.balances {
+		s.balances[addr] = c.State[addr]
+	}
+	for addr := range u.nonces {
+		s.nonces[addr] = c.Nonces[addr]
+	}
+	for key := range u.kv {
+		s.kv[key] = c.kv[key]
+	}
+	return s
+}
+
+func (u *stateUndo) revert(c *Chain) {
+	for addr, bal := range u.balances {
+		c.State[addr] = bal
+	}
+	for addr, prev := range u.nonces {
+		if prev.existed {
+			c.Nonces[addr] = prev.value
+		} else {
+			delete(c.Nonces, addr)
+		}
+	}
+	for key, v := range u.kv {
+		setKV(c.kv, key, v)
+		c.trie = c.trie.setStore(key, v)
+	}
+	for addr := range u.balances {
+		c.syncAccount(addr)
+	}
+	for addr := range u.nonces {
+		c.syncAccount(addr)
+	}
+}
+
+// syncAccount updates addr's leaf in the state trie from State and Nonces.
+func (c *Chain) syncAccount(addr string) {
+	c.trie = c.trie.setAccount(addr, c.State[addr], c.Nonces[addr])
+}
+
+// setKV stores v at key, deleting it if v is nil.
+func setKV(kv map[string][]byte, key string, v []byte) {
+	if v == nil {
+		delete(kv, key)
+	} else {
+		kv[key] = v
+	}
+}
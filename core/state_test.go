@@ -0,0 +1,168 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingHooks writes to the state in every hook, then fails if fail is set.
+type failingHooks struct {
+	NativeRouter
+	fail bool
+}
+
+var errHook = errors.New("hook failed")
+
+func (h failingHooks) BeginBlock(s State, _ *Header) error {
+	s.SetBalance("hook", s.Balance("hook")+1)
+	s.Store("test").Set([]byte("begin"), []byte("x"))
+	if h.fail {
+		return errHook
+	}
+	return nil
+}
+
+func (h failingHooks) EndBlock(s State, _ *Header) error {
+	s.Bond("hook", 1)
+	s.Store("test").Delete([]byte("key"))
+	if h.fail {
+		return errHook
+	}
+	return nil
+}
+
+func TestOverlayChildFlush(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	c.kv["test/key"] = []byte("chain")
+	s := c.newStateOverlay(c.head)
+	child := s.child()
+
+	child.SetBalance(a.addr, 600)
+	child.nonces[a.addr] = 1
+	child.Store("test").Set([]byte("key"), []byte("child"))
+	child.fees = 5
+	if got := child.balance(a.addr); got != 600 {
+		t.Errorf("child reads balance %d, want 600", got)
+	}
+	if got := s.balance(a.addr); got != 1000 {
+		t.Errorf("parent reads balance %d before flush, want 1000", got)
+	}
+	if got := string(s.Store("test").Get([]byte("key"))); got != "chain" {
+		t.Errorf("parent reads %q before flush, want chain", got)
+	}
+
+	// a grandchild reads through both layers
+	if got := child.child().balance(a.addr); got != 600 {
+		t.Errorf("grandchild reads balance %d, want 600", got)
+	}
+
+	child.flush()
+	if got := s.balance(a.addr); got != 600 {
+		t.Errorf("parent reads balance %d after flush, want 600", got)
+	}
+	if got := s.nonce(a.addr); got != 1 {
+		t.Errorf("parent reads nonce %d after flush, want 1", got)
+	}
+	if got := string(s.Store("test").Get([]byte("key"))); got != "child" {
+		t.Errorf("parent reads %q after flush, want child", got)
+	}
+	if s.fees != 5 {
+		t.Errorf("parent fees %d after flush, want 5", s.fees)
+	}
+	if c.State[a.addr] != 1000 || string(c.kv["test/key"]) != "chain" {
+		t.Error("flush reached the chain")
+	}
+}
+
+func TestOverlayDeletionShadows(t *testing.T) {
+	c := newTestChain(t, 0)
+	c.kv["test/a"] = []byte("1")
+	c.kv["test/b"] = []byte("2")
+	s := c.newStateOverlay(c.head)
+	child := s.child()
+	child.Store("test").Delete([]byte("a"))
+
+	st := child.Store("test")
+	if st.Has([]byte("a")) || st.Get([]byte("a")) != nil {
+		t.Error("deleted key still read in the child")
+	}
+	var keys []string
+	st.Iterate(nil, func(key, _ []byte) bool {
+		keys = append(keys, string(key))
+		return true
+	})
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("child iterates %v, want [b]", keys)
+	}
+	if !s.Store("test").Has([]byte("a")) {
+		t.Error("deletion reached the parent before flush")
+	}
+
+	child.flush()
+	if s.Store("test").Has([]byte("a")) {
+		t.Error("deletion lost in flush")
+	}
+	// a later layer can set the key again over the deletion
+	again := s.child()
+	again.Store("test").Set([]byte("a"), []byte("3"))
+	if got := string(again.Store("test").Get([]byte("a"))); got != "3" {
+		t.Errorf("reset key reads %q, want 3", got)
+	}
+	if string(c.kv["test/a"]) != "1" {
+		t.Error("deletion reached the chain")
+	}
+}
+
+func TestFailedTxLeavesParent(t *testing.T) {
+	a := newTestAccount(t)
+	c := newTestChain(t, 1000, a)
+	s := c.newStateOverlay(c.head)
+
+	// the fee is charged in the transaction's layer before the handler fails
+	tx := a.transfer(t, 1, 2000, 1)
+	if err := s.applyTx(&tx); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("got %v, want %v", err, ErrInsufficientFunds)
+	}
+	if len(s.balances) != 0 || len(s.nonces) != 0 || s.fees != 0 {
+		t.Errorf("failed tx left balances %v, nonces %v, fees %d", s.balances, s.nonces, s.fees)
+	}
+
+	tx = a.transfer(t, 1, 10, 1)
+	if err := s.applyTx(&tx); err != nil {
+		t.Fatal(err)
+	}
+	if s.nonce(a.addr) != 1 || s.fees != tx.Fee() {
+		t.Errorf("applied tx: nonce %d, fees %d", s.nonce(a.addr), s.fees)
+	}
+}
+
+func TestFailedHookLeavesParent(t *testing.T) {
+	c := newTestChain(t, 0)
+	c.kv["test/key"] = []byte("v")
+	h := &Header{Number: 1}
+
+	c.router = failingHooks{fail: true}
+	s := c.newStateOverlay(c.head)
+	if err := s.beginBlock(h); !errors.Is(err, errHook) {
+		t.Fatalf("begin block: got %v, want %v", err, errHook)
+	}
+	if err := s.endBlock(h); !errors.Is(err, errHook) {
+		t.Fatalf("end block: got %v, want %v", err, errHook)
+	}
+	if len(s.balances) != 0 || len(s.kv) != 0 || s.Stake("hook") != 0 {
+		t.Errorf("failed hooks left balances %v, kv %v, stake %d", s.balances, s.kv, s.Stake("hook"))
+	}
+
+	c.router = failingHooks{}
+	s = c.newStateOverlay(c.head)
+	if err := s.beginBlock(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.endBlock(h); err != nil {
+		t.Fatal(err)
+	}
+	if s.balance("hook") != 1 || s.Stake("hook") != 1 || !s.Store("test").Has([]byte("begin")) || s.Store("test").Has([]byte("key")) {
+		t.Errorf("hooks' writes missing: balances %v, kv %v", s.balances, s.kv)
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+)
+
+// Store is one namespace of the chain's key-value state, usually a module's,
+// as seen by the transaction or block being applied. Keys are stored under
+// the namespace followed by "/". Writes go to the state's cache layer and
+// reach the chain only when the transaction and its block succeed.
+type Store struct {
+	prefix string
+	state  *stateOverlay
+}
+
+// Store returns the namespace of the key-value state. The namespace must not
+// contain "/".
+func (s *stateOverlay) Store(namespace string) *Store {
+	if strings.Contains(namespace, "/") {
+		panic("core: store namespace " + namespace + " contains /")
+	}
+	return &Store{prefix: namespace + "/", state: s}
+}
+
+// Get returns a copy of the value at key, or nil if there is none.
+func (st *Store) Get(key []byte) []byte {
+	return bytes.Clone(st.state.kvGet(st.prefix + string(key)))
+}
+
+func (st *Store) Has(key []byte) bool {
+	return st.state.kvGet(st.prefix+string(key)) != nil
+}
+
+// Set stores a copy of value at key. An empty value deletes the key.
+func (st *Store) Set(key, value []byte) {
+	if len(value) == 0 {
+		st.Delete(key)
+		return
+	}
+	st.state.kv[st.prefix+string(key)] = bytes.Clone(value)
+}
+
+func (st *Store) Delete(key []byte) {
+	st.state.kv[st.prefix+string(key)] = nil
+}
+
+// Iterate calls fn for every key starting with prefix, in key order, until
+// fn returns false. Keys are passed without the namespace.
+func (st *Store) Iterate(prefix []byte, fn func(key, value []byte) bool) {
+	entries := st.state.kvRange(st.prefix + string(prefix))
+	for _, k := range sortedKeys(entries) {
+		if !fn([]byte(strings.TrimPrefix(k, st.prefix)), bytes.Clone(entries[k])) {
+			return
+		}
+	}
+}
+
+// Typed values, encoded as big-endian integers or JSON.
+
+func (st *Store) GetUint64(key []byte) uint64 {
+	v := st.state.kvGet(st.prefix + string(key))
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// SetUint64 stores v at key; zero deletes it.
+func (st *Store) SetUint64(key []byte, v uint64) {
+	if v == 0 {
+		st.Delete(key)
+		return
+	}
+	st.Set(key, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (st *Store) GetInt(key []byte) int { return int(st.GetUint64(key)) }
+
+// SetInt stores v at key; zero deletes it.
+func (st *Store) SetInt(key []byte, v int) { st.SetUint64(key, uint64(v)) }
+
+// GetJSON decodes the value at key into v. It reports false if there is none.
+func (st *Store) GetJSON(key []byte, v any) (bool, error) {
+	data := st.state.kvGet(st.prefix + string(key))
+	if data == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+func (st *Store) SetJSON(key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	st.Set(key, data)
+	return nil
+}
+
+// kvGet reads key through the cache layers down to the chain. A nil value
+// in a layer marks the key deleted.
+func (s *stateOverlay) kvGet(key string) []byte {
+	for l := s; l != nil; l = l.parent {
+		if v, ok := l.kv[key]; ok {
+			return v
+		}
+	}
+	return s.chain.kv[key]
+}
+
+// kvRange returns every live entry whose key starts with prefix.
+func (s *stateOverlay) kvRange(prefix string) map[string][]byte {
+	var out map[string][]byte
+	if s.parent != nil {
+		out = s.parent.kvRange(prefix)
+	} else {
+		out = make(map[string][]byte)
+		for k, v := range s.chain.kv {
+			if strings.HasPrefix(k, prefix) {
+				out[k] = v
+			}
+		}
+	}
+	for k, v := range s.kv {
+		if strings.HasPrefix(k, prefix) {
+			setKV(out, k, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package core
+
+import "errors"
+
+var ErrStaleTransition = errors.New("chain head moved since the state transition began")
+
+// StateTransition applies transactions one after another on top of the
+// chain head, buffering the changes without touching the chain. It is the
+// single path a transaction takes into state: RPC submission, the mempool
+// and the block builder all admit transactions through Apply, and blocks
+// run the same checks when they are validated.
+type StateTransition struct {
+	chain   *Chain
+	head    *blockNode
+	overlay *stateOverlay
+}
+
+// NewStateTransition starts a transition on the current head.
+func (c *Chain) NewStateTransition() *StateTransition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.newStateTransition()
+}
+
+// newStateTransition is NewStateTransition for callers holding c.mu.
+func (c *Chain) newStateTransition() *StateTransition {
+	overlay := c.newStateOverlay(c.head)
+	overlay.releaseUnbonded()
+	return &StateTransition{chain: c, head: c.head, overlay: overlay}
+}
+
+// Apply verifies tx and applies it on top of the transactions applied so
+// far. A transaction that fails leaves the transition unchanged.
+func (st *StateTransition) Apply(tx *Transaction) error {
+	st.chain.mu.RLock()
+	defer st.chain.mu.RUnlock()
+	if st.chain.head != st.head {
+		return ErrStaleTransition
+	}
+	return st.apply(tx)
+}
+
+// apply is Apply for callers holding the chain lock.
+func (st *StateTransition) apply(tx *Transaction) error {
+	if err := st.chain.validateTx(tx); err != nil {
+		return err
+	}
+	return st.overlay.applyTx(tx)
+}
+
+// Root returns the state root after the transactions applied so far, as in
+// a block without a coinbase.
+func (st *StateTransition) Root() (string, error) {
+	st.chain.mu.RLock()
+	defer st.chain.mu.RUnlock()
+	if st.chain.head != st.head {
+		return "", ErrStaleTransition
+	}
+	return st.overlay.root(), nil
+}
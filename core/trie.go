@@ -0,0 +1,327 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrStateUnavailable = errors.New("unknown or non-canonical block")
+	ErrInvalidProof     = errors.New("invalid state proof")
+)
+
+// The state is committed to by a sparse Merkle trie over the SHA-256 of each
+// key. It is compact: a leaf sits just below the longest prefix it shares
+// with any other key instead of at depth 256, and an empty subtree hashes to
+// 32 zero bytes. Nodes are never modified, so a block keeps the trie it
+// committed to for as long as it is referenced, sharing unchanged subtrees
+// with its neighbours.
+type trieNode struct {
+	hash        []byte
+	path        []byte // leaves only: the hash of the key
+	value       []byte // leaves only
+	left, right *trieNode
+}
+
+var emptyTrieHash = make([]byte, sha256.Size)
+
+// Trie keys. An account's leaf holds its balance and nonce, a store entry its
+// value and the staking leaf the whole ledger.
+const (
+	accountPrefix = "account/"
+	storePrefix   = "store/"
+	stakingKey    = "staking"
+)
+
+func trieLeafHash(path, valueHash []byte) []byte {
+	buf := make([]byte, 0, 1+len(path)+len(valueHash))
+	buf = append(buf, 0x00)
+	buf = append(buf, path...)
+	buf = append(buf, valueHash...)
+	h := sha256.Sum256(buf)
+	return h[:]
+}
+
+func newTrieLeaf(path, value []byte) *trieNode {
+	vh := sha256.Sum256(value)
+	return &trieNode{hash: trieLeafHash(path, vh[:]), path: path, value: value}
+}
+
+// newTrieBranch joins two subtrees, hoisting a leaf left without a sibling.
+func newTrieBranch(l, r *trieNode) *trieNode {
+	switch {
+	case l == nil && r == nil:
+		return nil
+	case l == nil && r.isLeaf():
+		return r
+	case r == nil && l.isLeaf():
+		return l
+	}
+	return &trieNode{hash: merkleNode(l.nodeHash(), r.nodeHash()), left: l, right: r}
+}
+
+func (n *trieNode) isLeaf() bool { return n != nil && n.path != nil }
+
+func (n *trieNode) nodeHash() []byte {
+	if n == nil {
+		return emptyTrieHash
+	}
+	return n.hash
+}
+
+func (n *trieNode) root() string { return hex.EncodeToString(n.nodeHash()) }
+
+func triePath(key string) []byte {
+	h := sha256.Sum256([]byte(key))
+	return h[:]
+}
+
+func pathBit(path []byte, depth int) byte {
+	return path[depth/8] >> (7 - depth%8) & 1
+}
+
+// set returns the trie with key set to value, or removed if value is nil.
+func (n *trieNode) set(key string, value []byte) *trieNode {
+	return n.update(0, triePath(key), value)
+}
+
+func (n *trieNode) update(depth int, path, value []byte) *trieNode {
+	switch {
+	case n == nil:
+		if value == nil {
+			return nil
+		}
+		return newTrieLeaf(path, value)
+	case n.isLeaf():
+		if bytes.Equal(n.path, path) {
+			if value == nil {
+				return nil
+			}
+			return newTrieLeaf(path, value)
+		}
+		if value == nil {
+			return n
+		}
+		return splitTrieLeaves(depth, n, newTrieLeaf(path, value))
+	}
+	if pathBit(path, depth) == 0 {
+		return newTrieBranch(n.left.update(depth+1, path, value), n.right)
+	}
+	return newTrieBranch(n.left, n.right.update(depth+1, path, value))
+}
+
+// splitTrieLeaves builds the subtree at depth holding two leaves.
+func splitTrieLeaves(depth int, a, b *trieNode) *trieNode {
+	ba, bb := pathBit(a.path, depth), pathBit(b.path, depth)
+	switch {
+	case ba < bb:
+		return newTrieBranch(a, b)
+	case ba > bb:
+		return newTrieBranch(b, a)
+	case ba == 0:
+		return newTrieBranch(splitTrieLeaves(depth+1, a, b), nil)
+	}
+	return newTrieBranch(nil, splitTrieLeaves(depth+1, a, b))
+}
+
+func (n *trieNode) get(key string) []byte {
+	path := triePath(key)
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		if pathBit(path, depth) == 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	if n != nil && bytes.Equal(n.path, path) {
+		return n.value
+	}
+	return nil
+}
+
+// StateProof proves the value of a state trie key, or that it has none,
+// against a state root.
+type StateProof struct {
+	Key      string   `json:"key"`
+	Value    string   `json:"value,omitempty"` // hex; empty if the key is absent
+	Siblings []string `json:"siblings"`        // from the root down
+	// For an absent key, the leaf found in its place, if any.
+	OtherPath      string `json:"otherPath,omitempty"`
+	OtherValueHash string `json:"otherValueHash,omitempty"`
+}
+
+func (n *trieNode) prove(key string) StateProof {
+	p := StateProof{Key: key, Siblings: []string{}}
+	path := triePath(key)
+	for depth := 0; n != nil && !n.isLeaf(); depth++ {
+		if pathBit(path, depth) == 0 {
+			p.Siblings = append(p.Siblings, hex.EncodeToString(n.right.nodeHash()))
+			n = n.left
+		} else {
+			p.Siblings = append(p.Siblings, hex.EncodeToString(n.left.nodeHash()))
+			n = n.right
+		}
+	}
+	switch {
+	case n == nil:
+	case bytes.Equal(n.path, path):
+		p.Value = hex.EncodeToString(n.value)
+	default:
+		vh := sha256.Sum256(n.value)
+		p.OtherPath = hex.EncodeToString(n.path)
+		p.OtherValueHash = hex.EncodeToString(vh[:])
+	}
+	return p
+}
+
+// Verify checks the proof against a state root.
+func (p *StateProof) Verify(root string) error {
+	path := triePath(p.Key)
+	if len(p.Siblings) >= len(path)*8 {
+		return fmt.Errorf("%w: %d siblings", ErrInvalidProof, len(p.Siblings))
+	}
+	h := emptyTrieHash
+	switch {
+	case p.Value != "":
+		value, err := hex.DecodeString(p.Value)
+		if err != nil {
+			return fmt.Errorf("%w: value: %v", ErrInvalidProof, err)
+		}
+		vh := sha256.Sum256(value)
+		h = trieLeafHash(path, vh[:])
+	case p.OtherPath != "":
+		other, err1 := hex.DecodeString(p.OtherPath)
+		vh, err2 := hex.DecodeString(p.OtherValueHash)
+		if err1 != nil || err2 != nil || len(other) != len(path) || len(vh) != sha256.Size {
+			return fmt.Errorf("%w: malformed leaf", ErrInvalidProof)
+		}
+		if bytes.Equal(other, path) {
+			return fmt.Errorf("%w: leaf is the key's own", ErrInvalidProof)
+		}
+		for depth := range p.Siblings {
+			if pathBit(other, depth) != pathBit(path, depth) {
+				return fmt.Errorf("%w: leaf is off the key's path", ErrInvalidProof)
+			}
+		}
+		h = trieLeafHash(other, vh)
+	}
+	for depth := len(p.Siblings) - 1; depth >= 0; depth-- {
+		sib, err := hex.DecodeString(p.Siblings[depth])
+		if err != nil || len(sib) != sha256.Size {
+			return fmt.Errorf("%w: sibling %d", ErrInvalidProof, depth)
+		}
+		if pathBit(path, depth) == 0 {
+			h = merkleNode(h, sib)
+		} else {
+			h = merkleNode(sib, h)
+		}
+	}
+	if got := hex.EncodeToString(h); got != root {
+		return fmt.Errorf("%w: root %s, want %s", ErrInvalidProof, got, root)
+	}
+	return nil
+}
+
+// Leaf encodings.
+
+func (n *trieNode) setAccount(addr string, bal int, nonce uint64) *trieNode {
+	if bal == 0 && nonce == 0 {
+		return n.set(accountPrefix+addr, nil)
+	}
+	return n.set(accountPrefix+addr, encodeAccount(bal, nonce))
+}
+
+func (n *trieNode) setStore(key string, v []byte) *trieNode {
+	return n.set(storePrefix+key, v)
+}
+
+func encodeAccount(bal int, nonce uint64) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(bal))
+	return binary.BigEndian.AppendUint64(buf, nonce)
+}
+
+func decodeAccount(value []byte) (bal int, nonce uint64) {
+	if len(value) != 16 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint64(value)), binary.BigEndian.Uint64(value[8:])
+}
+
+func (n *trieNode) setStaking(s *StakingState) *trieNode {
+	if s == nil || len(s.Stakes) == 0 && len(s.Unbonding) == 0 && len(s.Slashed) == 0 {
+		return n.set(stakingKey, nil)
+	}
+	var buf bytes.Buffer
+	for _, addr := range sortedKeys(s.Stakes) {
+		writeString(&buf, addr)
+		writeUint64(&buf, uint64(s.Stakes[addr]))
+	}
+	for _, u := range s.Unbonding {
+		writeString(&buf, u.Address)
+		writeUint64(&buf, uint64(u.Amount))
+		writeUint64(&buf, u.ReleaseHeight)
+	}
+	for _, key := range sortedKeys(s.Slashed) {
+		writeString(&buf, key)
+	}
+	return n.set(stakingKey, buf.Bytes())
+}
+
+// AccountProof is an account's balance and nonce after a block, with the
+// proof that the block's state root commits to them.
+type AccountProof struct {
+	Address     string     `json:"address"`
+	Balance     int        `json:"balance"`
+	Nonce       uint64     `json:"nonce"`
+	BlockNumber uint64     `json:"blockNumber"`
+	BlockHash   string     `json:"blockHash"`
+	StateRoot   string     `json:"stateRoot"`
+	Proof       StateProof `json:"proof"`
+}
+
+// Verify checks that the proof is for the account and its balance and nonce
+// and that it holds against StateRoot. The caller still has to trust the
+// block's header for the root.
+func (p *AccountProof) Verify() error {
+	if p.Proof.Key != accountPrefix+p.Address {
+		return fmt.Errorf("%w: proof is for %q", ErrInvalidProof, p.Proof.Key)
+	}
+	want := ""
+	if p.Balance != 0 || p.Nonce != 0 {
+		want = hex.EncodeToString(encodeAccount(p.Balance, p.Nonce))
+	}
+	if p.Proof.Value != want {
+		return fmt.Errorf("%w: value does not match balance and nonce", ErrInvalidProof)
+	}
+	return p.Proof.Verify(p.StateRoot)
+}
+
+// ProveAccount returns addr's balance and nonce after the canonical block
+// with the given hash, or the head if hash is empty, and their proof.
+func (c *Chain) ProveAccount(addr, hash string) (*AccountProof, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	n := c.head
+	if hash != "" {
+		var ok bool
+		n, ok = c.nodes[hash]
+		if !ok || n.block.Number >= uint64(len(c.Blocks)) || c.Blocks[n.block.Number].Hash != hash {
+			return nil, fmt.Errorf("%w: %s", ErrStateUnavailable, hash)
+		}
+	}
+	key := accountPrefix + addr
+	bal, nonce := decodeAccount(n.trie.get(key))
+	return &AccountProof{
+		Address:     addr,
+		Balance:     bal,
+		Nonce:       nonce,
+		BlockNumber: n.block.Number,
+		BlockHash:   n.block.Hash,
+		StateRoot:   n.block.StateRoot,
+		Proof:       n.trie.prove(key),
+	}, nil
+}
@@ -1,21 +1,30 @@
 package core
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"fmt"
-	"strconv"
+
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Transaction struct {
+	ChainID   uint64 // network the transaction is signed for
 	From      string
 	To        string
 	Amount    int
+	Type      string // routes the transaction to its handler: TxTransfer, TxBond, TxUnbond or a module's type
+	Data      string // arguments for the handler of Type, e.g. JSON for token transactions
 	Nonce     uint64
-	Timestamp int64
+	GasLimit  uint64 // most gas the sender will pay for, at least Gas()
+	GasPrice  int    // paid per unit of gas to the block's coinbase
 	Signature string // simplified for prototype (in prod use real cryptography)
 }
 
+// ID identifies tx by everything it carries: the keccak256 of its signing
+// hash and its length-prefixed signature. Blocks commit to it in TxRoot.
 func (tx *Transaction) ID() string {
-	h := sha256.Sum256([]byte(tx.From + tx.To + strconv.Itoa(tx.Amount) + strconv.FormatUint(tx.Nonce, 10) + tx.Signature))
-	return fmt.Sprintf("%x", h)
+	var buf bytes.Buffer
+	buf.Write(tx.SigningHash())
+	writeString(&buf, tx.Signature)
+	return fmt.Sprintf("%x", crypto.Keccak256(buf.Bytes()))
 }
@@ -0,0 +1,24 @@
+package core
+
+import "testing"
+
+func TestTxIDCoversEveryField(t *testing.T) {
+	base := Transaction{ChainID: 1, From: "ab", To: "c", Amount: 1, Type: TxTransfer, Data: "d", Nonce: 1, GasLimit: 21, GasPrice: 1, Signature: "s"}
+	variants := map[string]func(tx *Transaction){
+		"chain ID":  func(tx *Transaction) { tx.ChainID = 2 },
+		"type":      func(tx *Transaction) { tx.Type = TxBond },
+		"data":      func(tx *Transaction) { tx.Data = "e" },
+		"gas limit": func(tx *Transaction) { tx.GasLimit = 22 },
+		"gas price": func(tx *Transaction) { tx.GasPrice = 2 },
+		"signature": func(tx *Transaction) { tx.Signature = "t" },
+		// the old ID concatenated fields, so moving a character between them kept it
+		"field boundary": func(tx *Transaction) { tx.From, tx.To = "a", "bc" },
+	}
+	for name, change := range variants {
+		tx := base
+		change(&tx)
+		if tx.ID() == base.ID() {
+			t.Errorf("changing the %s keeps the ID", name)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxFutureBlockTime is how far ahead of the local clock a block timestamp may be.
+const MaxFutureBlockTime = 15 * time.Second
+
+var (
+	ErrUnknownParent     = errors.New("unknown parent block")
+	ErrKnownBlock        = errors.New("block already known")
+	ErrUnknownState      = errors.New("state of a side block is not known")
+	ErrInvalidNumber     = errors.New("block number is not sequential")
+	ErrInvalidHash       = errors.New("block hash does not match contents")
+	ErrTimestampTooOld   = errors.New("timestamp is older than parent")
+	ErrFutureBlock       = errors.New("timestamp is too far in the future")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrMissingSignature  = errors.New("missing signature")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrWrongChainID      = errors.New("transaction signed for another chain")
+	ErrNonceOrder        = errors.New("sender nonces are not consecutive within block")
+	ErrInvalidNonce      = errors.New("nonce already used")
+	ErrInsufficientFunds = errors.New("insufficient balance")
+	ErrInvalidTxRoot     = errors.New("transaction root mismatch")
+	ErrInvalidStateRoot  = errors.New("state root mismatch")
+	ErrInvalidCoinbase   = errors.New("coinbase is not an address")
+)
+
+// Validation stages, reported in BlockError.Stage.
+const (
+	StageHeader = "header"
+	StageBody   = "body"
+	StageState  = "state"
+)
+
+// BlockError explains why a block was rejected and at which stage.
+type BlockError struct {
+	Number uint64
+	Hash   string
+	Stage  string
+	Err    error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block %d (%s) rejected: %s: %v", e.Number, e.Hash, e.Stage, e.Err)
+}
+
+func (e *BlockError) Unwrap() error { return e.Err }
+
+// TxError identifies the offending transaction inside a block.
+type TxError struct {
+	Index int
+	ID    string
+	Err   error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("tx %d (%s): %v", e.Index, e.ID, e.Err)
+}
+
+func (e *TxError) Unwrap() error { return e.Err }
+
+// SealVerifier checks the consensus-specific seal of a block, e.g. PoW difficulty.
+type SealVerifier interface {
+	VerifySeal(chain ChainReader, b Block) error
+}
+
+// Clock is implemented by consensus engines that keep their own time, such as
+// the dev engine. Block timestamps are then checked against it instead of the
+// local clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// ChainReader gives consensus engines access to known blocks, canonical or
+// not. It is implemented by *Chain and by the view passed to VerifySeal,
+// which must be used instead of the chain while validation holds its lock.
+type ChainReader interface {
+	BlockByHash(hash string) (Block, bool)
+	// StakingAt returns the staking ledger as of a known block that is or was
+	// canonical; a side block's ledger is unknown. It must not be modified.
+	StakingAt(hash string) (*StakingState, bool)
+}
+
+// treeReader reads the block tree without locking. Callers must hold c.mu.
+type treeReader struct{ c *Chain }
+
+func (r treeReader) BlockByHash(hash string) (Block, bool) {
+	n, ok := r.c.nodes[hash]
+	if !ok {
+		return Block{}, false
+	}
+	return n.block, true
+}
+
+func (r treeReader) StakingAt(hash string) (*StakingState, bool) {
+	n, ok := r.c.nodes[hash]
+	if !ok || n.staking == nil {
+		return nil, false
+	}
+	return n.staking, true
+}
+
+func rejectBlock(b *Block, stage string, err error) error {
+	return &BlockError{Number: b.Number, Hash: b.Hash, Stage: stage, Err: err}
+}
+
+// validateStateless runs the header and body checks for b against its parent,
+// which must already be in the block tree, checking the seal with seal if it
+// is not nil. Callers must hold c.mu.
+func (c *Chain) validateStateless(b *Block, seal SealVerifier) (*blockNode, error) {
+	parent, ok := c.nodes[b.PrevHash]
+	if !ok {
+		return nil, rejectBlock(b, StageHeader, fmt.Errorf("%w: %s", ErrUnknownParent, b.PrevHash))
+	}
+	if err := c.validateHeader(&parent.block, b, seal); err != nil {
+		return nil, rejectBlock(b, StageHeader, err)
+	}
+	if err := c.validateBody(b); err != nil {
+		return nil, rejectBlock(b, StageBody, err)
+	}
+	return parent, nil
+}
+
+// validateState applies b on top of the current chain state and returns the
+// resulting changes uncommitted. b's parent must be the head.
+func (c *Chain) validateState(b *Block) (*stateOverlay, error) {
+	overlay := c.newStateOverlay(c.head)
+	if err := overlay.applyBlock(b); err != nil {
+		return nil, rejectBlock(b, StageState, err)
+	}
+	if root := overlay.root(); b.StateRoot != root {
+		return nil, rejectBlock(b, StageState, fmt.Errorf("%w: have %s, want %s", ErrInvalidStateRoot, b.StateRoot, root))
+	}
+	return overlay, nil
+}
+
+// now reads the engine's clock if it has one. Callers must hold c.mu.
+func (c *Chain) now() time.Time {
+	if clk, ok := c.sealVerifier.(Clock); ok {
+		return clk.Now()
+	}
+	return time.Now()
+}
+
+func (c *Chain) validateHeader(parent, b *Block, seal SealVerifier) error {
+	if b.Number != parent.Number+1 {
+		return fmt.Errorf("%w: have %d, want %d", ErrInvalidNumber, b.Number, parent.Number+1)
+	}
+	if b.Timestamp < parent.Timestamp {
+		return fmt.Errorf("%w: %d < %d", ErrTimestampTooOld, b.Timestamp, parent.Timestamp)
+	}
+	if b.Timestamp > c.now().Add(MaxFutureBlockTime).Unix() {
+		return fmt.Errorf("%w: %d", ErrFutureBlock, b.Timestamp)
+	}
+	if !validCoinbase(b.Coinbase) {
+		return fmt.Errorf("%w: %q", ErrInvalidCoinbase, b.Coinbase)
+	}
+	if h := b.ComputeHash(); b.Hash != h {
+		return fmt.Errorf("%w: have %s, want %s", ErrInvalidHash, b.Hash, h)
+	}
+	if seal != nil {
+		if err := seal.VerifySeal(treeReader{c}, *b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBody performs the state-independent transaction checks.
+func (c *Chain) validateBody(b *Block) error {
+	if limit := c.gasConfig().BlockGasLimit; limit > 0 && b.Gas() > limit {
+		return fmt.Errorf("%w: %d > %d", ErrBlockGasExceeded, b.Gas(), limit)
+	}
+	if root := MerkleRoot(b.TxIDs()); b.TxRoot != root {
+		return fmt.Errorf("%w: have %s, want %s", ErrInvalidTxRoot, b.TxRoot, root)
+	}
+	if root := MerkleRoot(b.EvidenceIDs()); b.EvidenceRoot != root {
+		return fmt.Errorf("%w: have %s, want %s", ErrInvalidEvidenceRoot, b.EvidenceRoot, root)
+	}
+	for i := range b.Evidence {
+		if _, err := b.Evidence[i].Offender(); err != nil {
+			return fmt.Errorf("evidence %d (%s): %w", i, b.Evidence[i].ID(), err)
+		}
+	}
+	lastNonce := make(map[string]uint64)
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		fail := func(err error) error { return &TxError{Index: i, ID: tx.ID(), Err: err} }
+		if err := c.validateTx(tx); err != nil {
+			return fail(err)
+		}
+		if prev, ok := lastNonce[tx.From]; ok && tx.Nonce != prev+1 {
+			return fail(fmt.Errorf("%w: %d after %d", ErrNonceOrder, tx.Nonce, prev))
+		}
+		lastNonce[tx.From] = tx.Nonce
+	}
+	return nil
+}
+
+// validateTx performs the state-independent checks on a single transaction
+// for this chain, including that a handler is routed for its type. Callers
+// must hold c.mu.
+func (c *Chain) validateTx(tx *Transaction) error {
+	if id := c.ChainID(); tx.ChainID != id {
+		return fmt.Errorf("%w: %d, want %d", ErrWrongChainID, tx.ChainID, id)
+	}
+	if _, ok := c.route(tx.Type); !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTxType, tx.Type)
+	}
+	return tx.Verify()
+}
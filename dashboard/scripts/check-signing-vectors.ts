@@ -0,0 +1,48 @@
+// Checks signTransaction against the vectors core/signature_test.go pins, so
+// the dashboard and the node agree on what is signed. Run with
+// `npm run test:signing`.
+import { readFileSync } from 'node:fs'
+import { ethers } from 'ethers'
+import { signingMessage, signTransaction, type TxPayload } from '../src/utils/crypto'
+
+// DevFaucetKey in core/genesis.go, which signed the vectors
+const DEV_FAUCET_KEY = 'ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80'
+
+interface SigningVector {
+  name: string
+  tx: TxPayload
+  message: string
+  hash: string
+  signature: string
+}
+
+const vectors: SigningVector[] = JSON.parse(
+  readFileSync(new URL('../../core/testdata/signing_vectors.json', import.meta.url), 'utf8')
+)
+
+async function check(): Promise<number> {
+  let failed = 0
+  for (const v of vectors) {
+    const message = ethers.hexlify(signingMessage(v.tx))
+    const hash = ethers.keccak256(message)
+    const signature = await signTransaction(v.tx, DEV_FAUCET_KEY)
+    for (const [field, got, want] of [
+      ['message', message, v.message],
+      ['hash', hash, v.hash],
+      ['signature', signature, v.signature]
+    ]) {
+      if (got !== want) {
+        console.error(`${v.name}: ${field} ${got}, want ${want}`)
+        failed++
+      }
+    }
+  }
+  return failed
+}
+
+check().then((failed) => {
+  if (failed > 0) {
+    process.exit(1)
+  }
+  console.log(`${vectors.length} signing vectors match`)
+})
@@ -113,6 +113,10 @@ export default function BlockCard({ block, isExpanded, onToggle }) {
                             <span className="text-[var(--text-secondary)]">Amount:</span>
                             <span className="text-[var(--accent-green)] font-semibold">{tx.Amount}</span>
                           </div>
+                          <div className="flex justify-between">
+                            <span className="text-[var(--text-secondary)]">Gas price:</span>
+                            <span className="terminal-font">{tx.GasPrice ?? 0}</span>
+                          </div>
                         </div>
                       </motion.div>
                     ))
@@ -9,6 +9,8 @@ interface Transaction {
   To: string;
   Amount: number;
   Nonce?: number;
+  GasLimit?: number;
+  GasPrice?: number;
   Signature?: string;
 }
 
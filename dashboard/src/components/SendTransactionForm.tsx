@@ -1,11 +1,13 @@
 import { useState } from 'react'
-import { signTransaction } from '../utils/crypto'
+import { signTransaction, TRANSFER_GAS } from '../utils/crypto'
+import { getChainId } from '../lib/rpc'
 
 interface TransactionData {
   from: string
   to: string
   amount: string
   nonce: string
+  gasPrice: string
   signature: string
 }
 
@@ -21,6 +23,7 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
     to: '',
     amount: '',
     nonce: '',
+    gasPrice: '1',
     signature: ''
   })
   const [wallet, setWallet] = useState<Wallet | null>(null)
@@ -84,9 +87,12 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
       const privKey = wallet ? wallet.privateKey : privateKey
       const amount = parseInt(formData.amount)
       const nonce = parseInt(formData.nonce)
+      const gasPrice = parseInt(formData.gasPrice)
+
+      const chainId = await getChainId(rpcUrl)
 
       // Client-side signing only - private key never sent to server
-      const txPayload = { from, to: formData.to, amount, nonce }
+      const txPayload = { chainId, from, to: formData.to, amount, nonce, gasLimit: TRANSFER_GAS, gasPrice }
       const signature = await signTransaction(txPayload, privKey)
 
       const response = await fetch(`${rpcUrl}/submitTx`, {
@@ -94,13 +100,7 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
         headers: {
           'Content-Type': 'application/json'
         },
-        body: JSON.stringify({
-          from,
-          to: formData.to,
-          amount,
-          nonce,
-          signature
-        })
+        body: JSON.stringify({ ...txPayload, signature })
       })
 
       if (!response.ok) {
@@ -117,6 +117,7 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
         to: '',
         amount: '',
         nonce: '',
+        gasPrice: formData.gasPrice,
         signature: ''
       })
     } catch (err) {
@@ -130,7 +131,7 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
     }
   }
 
-  const isFormValid = (formData.to.trim() && formData.amount.trim() && formData.nonce.trim()) &&
+  const isFormValid = (formData.to.trim() && formData.amount.trim() && formData.nonce.trim() && formData.gasPrice.trim()) &&
     (wallet || (formData.from.trim() && privateKey.trim()))
 
   return (
@@ -234,6 +235,24 @@ export default function SendTransactionForm({ rpcUrl }: { rpcUrl: string }) {
             required
           />
         </div>
+        <div>
+          <label htmlFor="gasPrice" className="block text-sm font-medium text-white-700 mb-1">
+            Gas Price
+          </label>
+          <input
+            id="gasPrice"
+            name="gasPrice"
+            type="number"
+            min="0"
+            value={formData.gasPrice}
+            onChange={handleChange}
+            className="w-full px-3 py-2 border border-gray-700 rounded-md focus:outline-none focus:ring-2 focus:ring-blue-500"
+            required
+          />
+          <p className="mt-1 text-xs text-gray-400">
+            Fee: {TRANSFER_GAS * (parseInt(formData.gasPrice) || 0)} ({TRANSFER_GAS} gas)
+          </p>
+        </div>
         <button
           type="submit"
           disabled={loading || !isFormValid}
@@ -1,7 +1,7 @@
 import { useState, useRef, useEffect } from 'react';
 import { Terminal as TerminalIcon } from 'lucide-react';
-import { getBalance, submitTransaction, addBalance } from '../lib/rpc';
-import { signTransaction } from '../utils/crypto';
+import { getBalance, getChainId, getNonce, submitTransaction, addBalance } from '../lib/rpc';
+import { signTransaction, TRANSFER_GAS } from '../utils/crypto';
 import { motion, AnimatePresence } from 'framer-motion';
 
 interface CommandResult {
@@ -86,7 +86,7 @@ export default function Terminal() {
   };
 
   const parseSendArgs = (args: string[]) => {
-    let to = '', amount = 0, from = '', privateKey = '';
+    let to = '', amount = 0, from = '', privateKey = '', gasPrice = 1;
 
     for (let i = 0; i < args.length; i++) {
       switch (args[i]) {
@@ -102,18 +102,21 @@ export default function Terminal() {
         case '--key':
           privateKey = args[++i] || '';
           break;
+        case '--gas-price':
+          gasPrice = parseInt(args[++i] || '1');
+          break;
       }
     }
 
-    return { to, amount, from, privateKey };
+    return { to, amount, from, privateKey, gasPrice };
   };
 
-  const executeSend = async (args: { to: string; amount: number; from: string; privateKey: string }) => {
-    const { to, amount } = args;
+  const executeSend = async (args: { to: string; amount: number; from: string; privateKey: string; gasPrice: number }) => {
+    const { to, amount, gasPrice } = args;
     let { from, privateKey } = args;
 
     if (!to || !amount) {
-      throw new Error('Usage: send --to <address> --amount <number> [--from <address> --key <privateKey>]');
+      throw new Error('Usage: send --to <address> --amount <number> [--gas-price <number>] [--from <address> --key <privateKey>]');
     }
 
     // Get wallet from localStorage if not provided
@@ -125,8 +128,8 @@ export default function Terminal() {
       privateKey = privateKey || walletData.privateKey;
     }
 
-    const nonce = Date.now();
-    const txPayload = { from, to, amount, nonce };
+    const [chainId, nonce] = await Promise.all([getChainId(), getNonce(from)]);
+    const txPayload = { chainId, from, to, amount, nonce, gasLimit: TRANSFER_GAS, gasPrice };
     const signature = await signTransaction(txPayload, privateKey);
 
     await submitTransaction({ ...txPayload, signature });
@@ -147,13 +150,13 @@ TX Hash: ${signature.slice(0, 16)}...`;
     if (!stored) throw new Error('No wallet found. Create one first.');
     const walletData = JSON.parse(stored);
     const result = await addBalance(walletData.address, amount);
-    return `Added ${amount} testcoins. New balance: ${result.newBalance}`;
+    return `Faucet sent ${amount} testcoins in tx ${result.txId}; they arrive with the next block.`;
   };
 
   const getHelpText = () => {
     return `
 Available commands:
-  send --to <address> --amount <number> [--from <address> --key <privateKey>]
+  send --to <address> --amount <number> [--gas-price <number>] [--from <address> --key <privateKey>]
     Send tokens to an address. Uses saved wallet if --from/--key not provided.
 
   balance <address>
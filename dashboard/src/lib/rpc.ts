@@ -12,6 +12,16 @@ export async function getBalance(address: string) {
   return data.balance ?? 0;
 }
 
+// Token balances by symbol, empty if the node has no token module.
+export async function getTokenBalances(address: string): Promise<Record<string, number>> {
+  if (!address) return {};
+  const url = `${RPC_BASE}/balance?addr=${encodeURIComponent(address)}`;
+  const res = await fetch(url);
+  if (!res.ok) throw new Error('failed to fetch balance');
+  const data = await res.json();
+  return data.tokens ?? {};
+}
+
 export async function requestFaucet(address: string) {
   const url = `${RPC_BASE}/api/faucet`;
   const res = await fetch(url, {
@@ -47,7 +57,19 @@ export async function callRPC(endpoint: string, options?: RequestInit, rpcUrl?:
   return response.json();
 }
 
-export async function submitTransaction(tx: { from: string; to: string; amount: number; nonce: number; signature: string }, rpcUrl?: string) {
+export async function getChainId(rpcUrl?: string): Promise<number> {
+  const data = await callRPC('/chainId', undefined, rpcUrl);
+  // expecting { chainId }
+  return data.chainId;
+}
+
+export async function getNonce(address: string, rpcUrl?: string): Promise<number> {
+  const data = await callRPC(`/nonce?addr=${encodeURIComponent(address)}`, undefined, rpcUrl);
+  // expecting { address, nonce }
+  return data.nonce;
+}
+
+export async function submitTransaction(tx: { chainId: number; from: string; to: string; amount: number; nonce: number; gasLimit: number; gasPrice: number; signature: string }, rpcUrl?: string) {
   return callRPC('/submitTx', {
     method: 'POST',
     body: JSON.stringify(tx),
@@ -74,13 +96,6 @@ export async function addBalance(userId: string, amount: number, rpcUrl?: string
   }, rpcUrl);
 }
 
-export async function resetBalance(address: string, rpcUrl?: string) {
-  return callRPC('/api/resetBalance', {
-    method: 'POST',
-    body: JSON.stringify({ address }),
-  }, rpcUrl);
-}
-
 export async function getHealth(rpcUrl?: string) {
   return callRPC('/health', undefined, rpcUrl);
 }
\ No newline at end of file
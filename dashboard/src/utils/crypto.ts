@@ -1,6 +1,55 @@
 import { ethers } from 'ethers'
 
-export async function signTransaction(txPayload: { from: string; to: string; amount: number; nonce: number }, privateKey: string): Promise<string> {
+// Gas a transfer uses; transactions must set gasLimit to at least this.
+export const TRANSFER_GAS = 21
+
+// Prefixes every signing payload; must match txDomain in core/signature.go.
+const TX_DOMAIN = 'modular-blockchain-framework/tx/v1'
+
+export interface TxPayload {
+  chainId: number
+  from: string
+  to: string
+  amount: number
+  type?: string
+  data?: string
+  nonce: number
+  gasLimit: number
+  gasPrice: number
+}
+
+function encodeUint64(n: number): Uint8Array {
+  return ethers.getBytes(ethers.toBeHex(BigInt(n), 8))
+}
+
+function encodeString(s: string): Uint8Array {
+  const bytes = ethers.toUtf8Bytes(s)
+  return ethers.getBytes(ethers.concat([encodeUint64(bytes.length), bytes]))
+}
+
+// Canonical payload the node verifies, see Transaction.SigningMessage: strings
+// length-prefixed, integers as big-endian uint64s, in this order. Data is only
+// appended when set. core/testdata/signing_vectors.json pins the bytes for both
+// sides; `npm run test:signing` checks this file against it.
+export function signingMessage(tx: TxPayload): Uint8Array {
+  const parts = [
+    encodeString(TX_DOMAIN),
+    encodeUint64(tx.chainId),
+    encodeString(tx.from),
+    encodeString(tx.to),
+    encodeUint64(tx.amount),
+    encodeString(tx.type ?? ''),
+    encodeUint64(tx.nonce),
+    encodeUint64(tx.gasLimit),
+    encodeUint64(tx.gasPrice)
+  ]
+  if (tx.data) {
+    parts.push(encodeString(tx.data))
+  }
+  return ethers.getBytes(ethers.concat(parts))
+}
+
+export async function signTransaction(txPayload: TxPayload, privateKey: string): Promise<string> {
   try {
     // Ensure private key starts with 0x
     let cleanPrivateKey = privateKey.trim()
@@ -9,8 +58,7 @@ export async function signTransaction(txPayload: { from: string; to: string; amo
     }
 
     const wallet = new ethers.Wallet(cleanPrivateKey)
-    const message = JSON.stringify(txPayload)
-    const messageHash = ethers.keccak256(ethers.toUtf8Bytes(message))
+    const messageHash = ethers.keccak256(signingMessage(txPayload))
     const rawSignature = wallet.signingKey.sign(messageHash)
     const signatureStruct = ethers.Signature.from(rawSignature)
     const recovery = signatureStruct.v >= 27 ? signatureStruct.v - 27 : signatureStruct.v
@@ -26,7 +74,7 @@ export async function signTransaction(txPayload: { from: string; to: string; amo
   }
 }
 
-export async function submitTransaction(rpcBaseUrl: string, txPayload: { from: string; to: string; amount: number; nonce: number }, signature: string) {
+export async function submitTransaction(rpcBaseUrl: string, txPayload: TxPayload, signature: string) {
   const body = { ...txPayload, signature }
   const response = await fetch(`${rpcBaseUrl}/submitTx`, {
     method: 'POST',
@@ -38,4 +38,21 @@ func Init() {
 		log.Fatalf("db ping failed: %v", err)
 	}
 	log.Println("Connected to Supabase")
+
+	if err := EnsureSchema(); err != nil {
+		log.Fatalf("db schema setup failed: %v", err)
+	}
+}
+
+// Enabled reports whether a database connection has been initialised.
+// Nodes running with the in-memory backend never call Init.
+func Enabled() bool { return DB != nil }
+
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	err := DB.Close()
+	DB = nil
+	return err
 }
@@ -1,13 +1,22 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"modular-blockchain-framework/core"
 )
 
+var ErrChainIDMismatch = errors.New("stored transaction is for another chain")
+
 func InsertBlock(block *core.Block) (err error) {
+	if !Enabled() {
+		return nil
+	}
 	tx, err := DB.Begin()
 	if err != nil {
 		return err
@@ -18,28 +27,61 @@ func InsertBlock(block *core.Block) (err error) {
 		}
 	}()
 
+	evidence, err := json.Marshal(block.Evidence)
+	if err != nil {
+		return err
+	}
+	var certificate []byte
+	if block.Certificate != nil {
+		if certificate, err = json.Marshal(block.Certificate); err != nil {
+			return err
+		}
+	}
+	// a row already at this height is either this block, persisted before,
+	// or one the chain has since dropped, which is replaced with its
+	// transactions and the blocks built on it
+	var stored string
+	switch err = tx.QueryRow(`SELECT hash FROM blocks WHERE number = $1`, int64(block.Number)).Scan(&stored); {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case stored == block.Hash:
+		return tx.Rollback()
+	default:
+		log.Printf("replacing stored block %d %s with %s", block.Number, stored, block.Hash)
+		if err = deleteBlocksFrom(tx, block.Number); err != nil {
+			return err
+		}
+	}
 	_, err = tx.Exec(
-		`INSERT INTO blocks (number, hash, prev_hash, nonce, timestamp)
-		 VALUES ($1,$2,$3,$4,$5)
-		 ON CONFLICT (number) DO NOTHING`,
+		`INSERT INTO blocks (number, hash, prev_hash, nonce, timestamp, tx_root, state_root, target, candidate, authorize, signature,
+		                     evidence_root, evidence, certificate, coinbase)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`,
 		int64(block.Number), block.Hash, block.PrevHash, int64(block.Nonce), time.Unix(block.Timestamp, 0),
+		block.TxRoot, block.StateRoot, block.Target, block.Candidate, block.Authorize, block.Signature,
+		block.EvidenceRoot, evidence, certificate, block.Coinbase,
 	)
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(`INSERT INTO transactions (block_number, from_addr, to_addr, amount, signature, created_at)
-	                          VALUES ($1,$2,$3,$4,$5,$6)`)
+	stmt, err := tx.Prepare(`INSERT INTO transactions (block_number, from_addr, to_addr, amount, nonce, type, gas_limit, gas_price, signature, created_at, chain_id, data)
+	                          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, t := range block.Transactions {
-		_, err = stmt.Exec(int64(block.Number), t.From, t.To, int64(t.Amount), t.Signature, time.Unix(t.Timestamp, 0))
+		_, err = stmt.Exec(int64(block.Number), t.From, t.To, int64(t.Amount), int64(t.Nonce), t.Type, int64(t.GasLimit), int64(t.GasPrice),
+			t.Signature, time.Unix(block.Timestamp, 0), int64(t.ChainID), t.Data)
 		if err != nil {
 			return err
 		}
+		if t.Type != core.TxTransfer {
+			// stake lives in the chain state, not in wallets
+			continue
+		}
 		if _, err = tx.Exec(`INSERT INTO wallets (address, balance, created_at) VALUES ($1, $2, now()) ON CONFLICT (address) DO NOTHING`, t.From, 0); err != nil {
 			return err
 		}
@@ -63,20 +105,89 @@ func InsertBlock(block *core.Block) (err error) {
 	return nil
 }
 
+// DeleteBlocksFrom removes blocks numbered from and above, reverting the
+// wallet balance updates their transactions made.
+func DeleteBlocksFrom(from uint64) (err error) {
+	if !Enabled() {
+		return nil
+	}
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = deleteBlocksFrom(tx, from); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteBlocksFrom(tx *sql.Tx, from uint64) error {
+	if _, err := tx.Exec(`UPDATE wallets w SET balance = w.balance + t.amount
+	                     FROM (SELECT from_addr, SUM(amount) AS amount FROM transactions WHERE block_number >= $1 AND type = '' GROUP BY from_addr) t
+	                     WHERE w.address = t.from_addr`, int64(from)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE wallets w SET balance = w.balance - t.amount
+	                     FROM (SELECT to_addr, SUM(amount) AS amount FROM transactions WHERE block_number >= $1 AND type = '' GROUP BY to_addr) t
+	                     WHERE w.address = t.to_addr`, int64(from)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM transactions WHERE block_number >= $1`, int64(from)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`DELETE FROM blocks WHERE number >= $1`, int64(from))
+	return err
+}
+
+// PersistChainEvent mirrors a canonical chain change into the database.
+func PersistChainEvent(ev core.ChainEvent) {
+	if len(ev.Removed) > 0 {
+		lowest := ev.Removed[len(ev.Removed)-1].Number
+		if err := DeleteBlocksFrom(lowest); err != nil {
+			log.Println("warning: failed to remove reorged blocks:", err)
+		}
+	}
+	for i := range ev.Added {
+		if err := InsertBlock(&ev.Added[i]); err != nil {
+			log.Println("warning: failed to persist block:", err)
+		}
+	}
+}
+
 func GetLatestBlockNumber() (int, error) {
+	if !Enabled() {
+		return -1, nil
+	}
 	var n int
 	err := DB.QueryRow(`SELECT COALESCE(MAX(number), -1) FROM blocks`).Scan(&n)
 	return n, err
 }
 
 func UpsertWalletBalance(address string, balance int) error {
+	if !Enabled() {
+		return nil
+	}
 	_, err := DB.Exec(`INSERT INTO wallets(address,balance,created_at) VALUES($1,$2,now())
 	                   ON CONFLICT (address) DO UPDATE SET balance = $2`, address, balance)
 	return err
 }
 
-func LoadChain() ([]core.Block, error) {
-	rows, err := DB.Query(`SELECT number, hash, prev_hash, nonce, extract(epoch from timestamp)::bigint as ts
+// LoadChain reads the stored blocks in order. A stored transaction for
+// another chain than want is an error: its signature cannot verify, so the
+// blocks could never be restored. Rows persisted before chain IDs were
+// recorded hold chain 0 and are refused the same way; setting their chain_id
+// would not help, as their signatures predate the chain ID too.
+func LoadChain(want uint64) ([]core.Block, error) {
+	if !Enabled() {
+		return nil, nil
+	}
+	rows, err := DB.Query(`SELECT number, hash, prev_hash, nonce, extract(epoch from timestamp)::bigint as ts, tx_root, state_root, target,
+	                               candidate, authorize, signature, evidence_root, evidence, certificate, coinbase
 	                        FROM blocks ORDER BY number ASC`)
 	if err != nil {
 		return nil, err
@@ -86,33 +197,61 @@ func LoadChain() ([]core.Block, error) {
 	var blocks []core.Block
 	for rows.Next() {
 		var (
-			number int64
-			nonce  int64
-			ts     int64
-			b      core.Block
+			number      int64
+			nonce       int64
+			ts          int64
+			evidence    []byte
+			certificate []byte
+			b           core.Block
 		)
-		if err := rows.Scan(&number, &b.Hash, &b.PrevHash, &nonce, &ts); err != nil {
+		if err := rows.Scan(&number, &b.Hash, &b.PrevHash, &nonce, &ts, &b.TxRoot, &b.StateRoot, &b.Target,
+			&b.Candidate, &b.Authorize, &b.Signature, &b.EvidenceRoot, &evidence, &certificate, &b.Coinbase); err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(evidence, &b.Evidence); err != nil {
+			return nil, err
+		}
+		if certificate != nil {
+			b.Certificate = new(core.CommitCertificate)
+			if err := json.Unmarshal(certificate, b.Certificate); err != nil {
+				return nil, err
+			}
+		}
 		b.Number = uint64(number)
 		b.Nonce = uint64(nonce)
 		b.Timestamp = ts
-		txrows, err := DB.Query(`SELECT from_addr,to_addr,amount,signature,extract(epoch from created_at)::bigint as ts FROM transactions WHERE block_number=$1`, number)
+		txrows, err := DB.Query(`SELECT from_addr,to_addr,amount,nonce,type,gas_limit,gas_price,signature,chain_id,data
+		                         FROM transactions WHERE block_number=$1 ORDER BY id ASC`, number)
 		if err != nil {
 			return nil, err
 		}
 		for txrows.Next() {
 			var (
-				tx     core.Transaction
-				amount int64
-				txTs   int64
+				tx       core.Transaction
+				amount   int64
+				nonce    int64
+				gasLimit int64
+				gasPrice int64
+				chainID  int64
 			)
-			if err := txrows.Scan(&tx.From, &tx.To, &amount, &tx.Signature, &txTs); err != nil {
+			if err := txrows.Scan(&tx.From, &tx.To, &amount, &nonce, &tx.Type, &gasLimit, &gasPrice, &tx.Signature, &chainID, &tx.Data); err != nil {
 				txrows.Close()
 				return nil, err
 			}
 			tx.Amount = int(amount)
-			tx.Timestamp = txTs
+			tx.Nonce = uint64(nonce)
+			tx.GasLimit = uint64(gasLimit)
+			tx.GasPrice = int(gasPrice)
+			tx.ChainID = uint64(chainID)
+			if tx.ChainID == 0 {
+				txrows.Close()
+				return nil, fmt.Errorf("%w: block %d holds a transaction stored before chain IDs were recorded, "+
+					"whose signature does not cover one; clear the blocks and transactions tables", ErrChainIDMismatch, number)
+			}
+			if tx.ChainID != want {
+				txrows.Close()
+				return nil, fmt.Errorf("%w: block %d holds a transaction for chain %d, node runs chain %d", ErrChainIDMismatch, number, tx.ChainID, want)
+			}
 			b.Transactions = append(b.Transactions, tx)
 		}
 		txrows.Close()
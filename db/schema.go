@@ -0,0 +1,55 @@
+package db
+
+// schema creates the tables the node persists to. Statements are idempotent so
+// they can run against an existing Supabase project on every start.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS blocks (
+		number    BIGINT PRIMARY KEY,
+		hash      TEXT NOT NULL,
+		prev_hash TEXT NOT NULL,
+		nonce     BIGINT NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS transactions (
+		id           BIGSERIAL PRIMARY KEY,
+		block_number BIGINT NOT NULL REFERENCES blocks(number),
+		from_addr    TEXT NOT NULL,
+		to_addr      TEXT NOT NULL,
+		amount       BIGINT NOT NULL,
+		signature    TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS wallets (
+		address    TEXT PRIMARY KEY,
+		balance    BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS id BIGSERIAL`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS nonce BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS tx_root TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS state_root TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS target TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS candidate TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS authorize BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS signature TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS evidence_root TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS evidence JSONB NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS certificate JSONB`,
+	`ALTER TABLE blocks ADD COLUMN IF NOT EXISTS coinbase TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS gas_limit BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS gas_price BIGINT NOT NULL DEFAULT 0`,
+	// rows stored before this column hold chain 0, which LoadChain refuses; they
+	// were signed without a chain ID, so the tables must be cleared, not migrated
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS chain_id BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE transactions ADD COLUMN IF NOT EXISTS data TEXT NOT NULL DEFAULT ''`,
+}
+
+func EnsureSchema() error {
+	for _, stmt := range schema {
+		if _, err := DB.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package modules
+
+import (
+	"fmt"
+
+	"modular-blockchain-framework/core"
+)
+
+// Manager holds the registered modules and routes transactions to them by
+// type. Modules are registered at startup, before Init installs the manager
+// as the chain's router.
+type Manager struct {
+	modules []Module
+	routes  map[string]Module
+}
+
+// NewManager returns a manager with the native bank and staking modules.
+func NewManager() *Manager {
+	mm := &Manager{routes: make(map[string]Module)}
+	mm.Register(BankModule{})
+	mm.Register(StakingModule{})
+	return mm
+}
+
+// Register adds m. It fails if m's name or any of its transaction types is
+// already taken.
+func (mm *Manager) Register(m Module) error {
+	for _, other := range mm.modules {
+		if other.Name() == m.Name() {
+			return fmt.Errorf("module %q already registered", m.Name())
+		}
+	}
+	for _, t := range m.TxTypes() {
+		if other, ok := mm.routes[t]; ok {
+			return fmt.Errorf("module %q: transaction type %q already routed to %q", m.Name(), t, other.Name())
+		}
+	}
+	for _, t := range m.TxTypes() {
+		mm.routes[t] = m
+	}
+	mm.modules = append(mm.modules, m)
+	return nil
+}
+
+// Init initialises every module in registration order and makes the
+// manager c's transaction router, which runs the modules' genesis hooks.
+func (mm *Manager) Init(c *core.Chain) error {
+	for _, m := range mm.modules {
+		m.Init(c)
+	}
+	return c.SetRouter(mm)
+}
+
+func (mm *Manager) Route(txType string) (core.TxHandler, bool) {
+	m, ok := mm.routes[txType]
+	return m, ok
+}
+
+func (mm *Manager) InitGenesis(s core.State, g *core.Genesis) error {
+	for _, m := range mm.modules {
+		if hook, ok := m.(GenesisModule); ok {
+			if err := hook.InitGenesis(s, g.Modules[m.Name()]); err != nil {
+				return fmt.Errorf("module %s: %w", m.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (mm *Manager) BeginBlock(s core.State, h *core.Header) error {
+	for _, m := range mm.modules {
+		if hook, ok := m.(BeginBlocker); ok {
+			if err := hook.BeginBlock(s, h); err != nil {
+				return fmt.Errorf("module %s: %w", m.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (mm *Manager) EndBlock(s core.State, h *core.Header) error {
+	for _, m := range mm.modules {
+		if hook, ok := m.(EndBlocker); ok {
+			if err := hook.EndBlock(s, h); err != nil {
+				return fmt.Errorf("module %s: %w", m.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (mm *Manager) Commit(b *core.Block) {
+	for _, m := range mm.modules {
+		if hook, ok := m.(Committer); ok {
+			hook.Commit(b)
+		}
+	}
+}
+
+// Modules returns the registered modules in registration order.
+func (mm *Manager) Modules() []Module {
+	return append([]Module(nil), mm.modules...)
+}
@@ -1,9 +1,42 @@
 package modules
 
-import "modular-blockchain-framework/core"
+import (
+	"encoding/json"
 
+	"modular-blockchain-framework/core"
+)
+
+// Module extends the chain with its own transaction types. The chain routes
+// each transaction whose Type the module claims to its CheckTx and ExecTx.
+// A module keeps its own state in s.Store(Name()).
 type Module interface {
+	core.TxHandler
 	Name() string
 	Init(c *core.Chain)
-	HandleTransaction(tx core.Transaction) error
-}
\ No newline at end of file
+	TxTypes() []string
+}
+
+// Optional block lifecycle hooks. The manager calls each in module
+// registration order, and an error from any aborts the block.
+
+// GenesisModule sets up the module's state from its section of the genesis
+// file's "modules", which is nil if there is none.
+type GenesisModule interface {
+	InitGenesis(s core.State, data json.RawMessage) error
+}
+
+// BeginBlocker runs before a block's transactions. See core.BlockBeginner.
+type BeginBlocker interface {
+	BeginBlock(s core.State, h *core.Header) error
+}
+
+// EndBlocker runs after a block's transactions. See core.BlockEnder.
+type EndBlocker interface {
+	EndBlock(s core.State, h *core.Header) error
+}
+
+// Committer is told about every block written to the chain. See
+// core.BlockCommitter.
+type Committer interface {
+	Commit(b *core.Block)
+}
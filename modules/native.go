@@ -0,0 +1,17 @@
+package modules
+
+import "modular-blockchain-framework/core"
+
+// BankModule handles plain transfers of the native balance.
+type BankModule struct{ core.TransferHandler }
+
+func (BankModule) Name() string      { return "bank" }
+func (BankModule) Init(*core.Chain)  {}
+func (BankModule) TxTypes() []string { return []string{core.TxTransfer} }
+
+// StakingModule handles bonding and unbonding stake.
+type StakingModule struct{ core.StakingHandler }
+
+func (StakingModule) Name() string      { return "staking" }
+func (StakingModule) Init(*core.Chain)  {}
+func (StakingModule) TxTypes() []string { return []string{core.TxBond, core.TxUnbond} }
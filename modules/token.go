@@ -1,24 +1,284 @@
 package modules
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+
 	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Token transaction types. Data holds the transaction's TokenArgs as JSON,
+// naming the token by symbol, and Amount the amount moved. To is the
+// recipient of mint, transfer and transferFrom and the spender of approve.
+const (
+	TxTokenCreate       = "token/create"       // Amount is minted to the creator
+	TxTokenMint         = "token/mint"         // by the token's minter only
+	TxTokenBurn         = "token/burn"         // from the sender's balance
+	TxTokenTransfer     = "token/transfer"     // from the sender's balance
+	TxTokenApprove      = "token/approve"      // sets the spender's allowance to Amount; 0 revokes it
+	TxTokenTransferFrom = "token/transferFrom" // from Owner's balance, spending the sender's allowance
 )
 
+var (
+	ErrInvalidTokenArgs = errors.New("invalid token transaction data")
+	ErrInvalidAddress   = errors.New("invalid address")
+	ErrUnknownToken     = errors.New("unknown token")
+	ErrTokenExists      = errors.New("token already exists")
+	ErrNotMinter        = errors.New("sender is not the token's minter")
+	ErrSupplyCap        = errors.New("token supply cap exceeded")
+	ErrTokenBalance     = errors.New("insufficient token balance")
+	ErrAllowance        = errors.New("insufficient allowance")
+)
+
+var symbolPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,10}$`)
+
+// Token is a fungible token's metadata and current supply. Amounts are in
+// the token's smallest unit; Decimals only tells wallets how to show them.
+type Token struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals"`
+	Cap      int    `json:"cap"` // most that may ever be in supply; 0 for no cap
+	Minter   string `json:"minter"`
+	Supply   int    `json:"supply"`
+}
+
+// TokenArgs is the Data of a token transaction.
+type TokenArgs struct {
+	Token string `json:"token"` // symbol
+
+	// create
+	Name     string `json:"name,omitempty"`
+	Decimals uint8  `json:"decimals,omitempty"`
+	Cap      int    `json:"cap,omitempty"`
+	Minter   string `json:"minter,omitempty"` // the creator if empty
+
+	// transferFrom
+	Owner string `json:"owner,omitempty"`
+}
+
+// TokenModule keeps any number of fungible tokens in its store: their
+// metadata under info/<symbol>, balances under balance/<symbol>/<address>
+// and allowances under allowance/<symbol>/<owner>/<spender>. Addresses are
+// stored checksummed.
 type TokenModule struct {
 	chain *core.Chain
 }
 
-func (m *TokenModule) Name() string { return "token" }
+func (m *TokenModule) Name() string       { return "token" }
 func (m *TokenModule) Init(c *core.Chain) { m.chain = c }
 
-// Very naive checks for prototype: signature + nonce checks are omitted for brevity
-func (m *TokenModule) HandleTransaction(tx core.Transaction) error {
-	if m.chain.GetBalance(tx.From) < tx.Amount {
-		return errors.New("insufficient funds")
+func (m *TokenModule) TxTypes() []string {
+	return []string{TxTokenCreate, TxTokenMint, TxTokenBurn, TxTokenTransfer, TxTokenApprove, TxTokenTransferFrom}
+}
+
+func infoKey(symbol string) []byte { return []byte("info/" + symbol) }
+
+func balanceKey(symbol, addr string) []byte { return []byte("balance/" + symbol + "/" + addr) }
+
+func allowanceKey(symbol, owner, spender string) []byte {
+	return []byte("allowance/" + symbol + "/" + owner + "/" + spender)
+}
+
+// tokenOp is a token transaction that passed its checks.
+type tokenOp struct {
+	token           *Token
+	from, to, owner string
+}
+
+func (m *TokenModule) CheckTx(s core.State, tx *core.Transaction) error {
+	_, err := m.check(s.Store(m.Name()), tx)
+	return err
+}
+
+// ExecTx applies tx. The chain has just run CheckTx on the same state, so the
+// checks, run again for the operation they yield, cannot fail; if they do
+// anyway the transaction is left without effect and reported.
+func (m *TokenModule) ExecTx(s core.State, tx *core.Transaction) {
+	st := s.Store(m.Name())
+	op, err := m.check(st, tx)
+	if err != nil {
+		log.Printf("warning: token tx %s failed its checks after CheckTx passed: %v", tx.ID(), err)
+		return
+	}
+	sym, amount := op.token.Symbol, tx.Amount
+	switch tx.Type {
+	case TxTokenCreate:
+		op.token.Supply = amount
+		addTokenBalance(st, sym, op.from, amount)
+	case TxTokenMint:
+		op.token.Supply += amount
+		addTokenBalance(st, sym, op.to, amount)
+	case TxTokenBurn:
+		op.token.Supply -= amount
+		addTokenBalance(st, sym, op.from, -amount)
+	case TxTokenTransfer:
+		addTokenBalance(st, sym, op.from, -amount)
+		addTokenBalance(st, sym, op.to, amount)
+		return
+	case TxTokenApprove:
+		st.SetInt(allowanceKey(sym, op.from, op.to), amount)
+		return
+	case TxTokenTransferFrom:
+		key := allowanceKey(sym, op.owner, op.from)
+		st.SetInt(key, st.GetInt(key)-amount)
+		addTokenBalance(st, sym, op.owner, -amount)
+		addTokenBalance(st, sym, op.to, amount)
+		return
+	}
+	st.SetJSON(infoKey(sym), op.token)
+}
+
+func (m *TokenModule) check(st *core.Store, tx *core.Transaction) (*tokenOp, error) {
+	var args TokenArgs
+	if err := json.Unmarshal([]byte(tx.Data), &args); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTokenArgs, err)
+	}
+	op := &tokenOp{from: core.NormalizeAddress(tx.From)}
+	if tx.Type == TxTokenCreate {
+		return op, checkCreate(st, tx, &args, op)
+	}
+	token, ok := loadToken(st, args.Token)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownToken, args.Token)
+	}
+	op.token = token
+	if tx.Type != TxTokenBurn {
+		if !common.IsHexAddress(tx.To) {
+			return nil, fmt.Errorf("%w: to %q", ErrInvalidAddress, tx.To)
+		}
+		op.to = core.NormalizeAddress(tx.To)
 	}
-	// apply immediately into a temporary state; real code would apply during block finalize
-	m.chain.AddBalance(tx.From, -tx.Amount)
-	m.chain.AddBalance(tx.To, tx.Amount)
+	if tx.Amount <= 0 && tx.Type != TxTokenApprove {
+		return nil, core.ErrInvalidAmount
+	}
+	switch tx.Type {
+	case TxTokenMint:
+		if op.from != token.Minter {
+			return nil, ErrNotMinter
+		}
+		if tx.Amount > math.MaxInt-token.Supply || token.Cap > 0 && token.Supply+tx.Amount > token.Cap {
+			return nil, fmt.Errorf("%w: supply %d, cap %d, minting %d", ErrSupplyCap, token.Supply, token.Cap, tx.Amount)
+		}
+	case TxTokenBurn, TxTokenTransfer:
+		if err := checkTokenBalance(st, token.Symbol, op.from, tx.Amount); err != nil {
+			return nil, err
+		}
+	case TxTokenTransferFrom:
+		if !common.IsHexAddress(args.Owner) {
+			return nil, fmt.Errorf("%w: owner %q", ErrInvalidAddress, args.Owner)
+		}
+		op.owner = core.NormalizeAddress(args.Owner)
+		if allowed := st.GetInt(allowanceKey(token.Symbol, op.owner, op.from)); allowed < tx.Amount {
+			return nil, fmt.Errorf("%w: have %d, need %d", ErrAllowance, allowed, tx.Amount)
+		}
+		if err := checkTokenBalance(st, token.Symbol, op.owner, tx.Amount); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+func checkCreate(st *core.Store, tx *core.Transaction, args *TokenArgs, op *tokenOp) error {
+	if !symbolPattern.MatchString(args.Token) {
+		return fmt.Errorf("%w: symbol %q must be 1-11 capital letters or digits", ErrInvalidTokenArgs, args.Token)
+	}
+	if st.Has(infoKey(args.Token)) {
+		return fmt.Errorf("%w: %s", ErrTokenExists, args.Token)
+	}
+	if args.Cap < 0 {
+		return fmt.Errorf("%w: negative cap", ErrInvalidTokenArgs)
+	}
+	if args.Cap > 0 && tx.Amount > args.Cap {
+		return fmt.Errorf("%w: cap %d, minting %d", ErrSupplyCap, args.Cap, tx.Amount)
+	}
+	minter := op.from
+	if args.Minter != "" {
+		if !common.IsHexAddress(args.Minter) {
+			return fmt.Errorf("%w: minter %q", ErrInvalidAddress, args.Minter)
+		}
+		minter = core.NormalizeAddress(args.Minter)
+	}
+	op.token = &Token{Symbol: args.Token, Name: args.Name, Decimals: args.Decimals, Cap: args.Cap, Minter: minter}
 	return nil
-}
\ No newline at end of file
+}
+
+func loadToken(st *core.Store, symbol string) (*Token, bool) {
+	var t Token
+	if ok, err := st.GetJSON(infoKey(symbol), &t); !ok || err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+func checkTokenBalance(st *core.Store, symbol, addr string, amount int) error {
+	if bal := st.GetInt(balanceKey(symbol, addr)); bal < amount {
+		return fmt.Errorf("%w: have %d %s, need %d", ErrTokenBalance, bal, symbol, amount)
+	}
+	return nil
+}
+
+func addTokenBalance(st *core.Store, symbol, addr string, amount int) {
+	key := balanceKey(symbol, addr)
+	st.SetInt(key, st.GetInt(key)+amount)
+}
+
+// Queries against the head state.
+
+// Token returns the token with the given symbol.
+func (m *TokenModule) Token(symbol string) (Token, bool) {
+	var t *Token
+	m.chain.View(func(s core.State) { t, _ = loadToken(s.Store(m.Name()), symbol) })
+	if t == nil {
+		return Token{}, false
+	}
+	return *t, true
+}
+
+// Tokens returns every token in symbol order.
+func (m *TokenModule) Tokens() []Token {
+	var tokens []Token
+	m.chain.View(func(s core.State) {
+		s.Store(m.Name()).Iterate([]byte("info/"), func(_, value []byte) bool {
+			var t Token
+			if json.Unmarshal(value, &t) == nil {
+				tokens = append(tokens, t)
+			}
+			return true
+		})
+	})
+	return tokens
+}
+
+// Balances returns addr's balance of every token it holds, by symbol.
+func (m *TokenModule) Balances(addr string) map[string]int {
+	addr = core.NormalizeAddress(addr)
+	balances := make(map[string]int)
+	m.chain.View(func(s core.State) {
+		st := s.Store(m.Name())
+		st.Iterate([]byte("info/"), func(key, _ []byte) bool {
+			symbol := string(key[len("info/"):])
+			if bal := st.GetInt(balanceKey(symbol, addr)); bal != 0 {
+				balances[symbol] = bal
+			}
+			return true
+		})
+	})
+	return balances
+}
+
+// Allowance returns how much of owner's symbol balance spender may transfer.
+func (m *TokenModule) Allowance(symbol, owner, spender string) int {
+	var allowed int
+	m.chain.View(func(s core.State) {
+		key := allowanceKey(symbol, core.NormalizeAddress(owner), core.NormalizeAddress(spender))
+		allowed = s.Store(m.Name()).GetInt(key)
+	})
+	return allowed
+}
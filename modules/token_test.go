@@ -0,0 +1,186 @@
+package modules_test
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/core"
+	"modular-blockchain-framework/modules"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type account struct {
+	key   *ecdsa.PrivateKey
+	addr  string
+	nonce uint64
+}
+
+func newAccount(t *testing.T) *account {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &account{key: key, addr: crypto.PubkeyToAddress(key.PublicKey).Hex()}
+}
+
+// tokenTx returns a's next transaction of type txType, signed.
+func (a *account) tokenTx(t *testing.T, txType, to string, amount int, data string) core.Transaction {
+	t.Helper()
+	a.nonce++
+	tx := core.Transaction{ChainID: core.DefaultChainID, From: a.addr, To: to, Amount: amount, Type: txType, Data: data,
+		Nonce: a.nonce, GasLimit: core.GasTransfer, GasPrice: 1}
+	sig, err := crypto.Sign(tx.SigningHash(), a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = hexutil.Encode(sig)
+	return tx
+}
+
+type tokenChain struct {
+	chain   *core.Chain
+	tokens  *modules.TokenModule
+	mempool *core.Mempool
+	engine  *consensus.Dev
+}
+
+// newTokenChain returns a chain running the token module, with each account funded.
+func newTokenChain(t *testing.T, accounts ...*account) *tokenChain {
+	t.Helper()
+	g := core.DefaultGenesis()
+	for _, a := range accounts {
+		g.Alloc[a.addr] = 10000
+	}
+	c := core.NewChainWithGenesis(g)
+	mm := modules.NewManager()
+	tokens := &modules.TokenModule{}
+	if err := mm.Register(tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := mm.Init(c); err != nil {
+		t.Fatal(err)
+	}
+	m := core.NewMempool()
+	m.SetNonceSource(c.GetNonce)
+	return &tokenChain{chain: c, tokens: tokens, mempool: m, engine: consensus.NewDev(c, m, consensus.DefaultDevConfig())}
+}
+
+// mine checks tx against the head and seals it in a block of its own.
+func (tc *tokenChain) mine(t *testing.T, tx core.Transaction) {
+	t.Helper()
+	if err := tc.chain.CheckTx(&tx); err != nil {
+		t.Fatalf("%s: %v", tx.Type, err)
+	}
+	if err := tc.mempool.Push(tx); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := tc.engine.Mine(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks[0].Transactions) != 1 {
+		t.Fatalf("%s left out of block %d", tx.Type, blocks[0].Number)
+	}
+}
+
+// reject checks that tx fails with want against the head, then forgets it.
+func (tc *tokenChain) reject(t *testing.T, a *account, tx core.Transaction, want error) {
+	t.Helper()
+	if err := tc.chain.CheckTx(&tx); !errors.Is(err, want) {
+		t.Errorf("%s: got %v, want %v", tx.Type, err, want)
+	}
+	a.nonce--
+}
+
+func (tc *tokenChain) balance(t *testing.T, symbol, addr string, want int) {
+	t.Helper()
+	if got := tc.tokens.Balances(addr)[symbol]; got != want {
+		t.Errorf("%s balance of %s: %d, want %d", symbol, addr, got, want)
+	}
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	alice, bob, carol := newAccount(t), newAccount(t), newAccount(t)
+	tc := newTokenChain(t, alice, bob, carol)
+
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenCreate, "", 500, `{"token":"ABC","name":"Alphabet","decimals":2,"cap":1000}`))
+	token, ok := tc.tokens.Token("ABC")
+	if !ok {
+		t.Fatal("token not created")
+	}
+	if token.Supply != 500 || token.Cap != 1000 || token.Minter != alice.addr || token.Decimals != 2 {
+		t.Errorf("created %+v", token)
+	}
+	tc.balance(t, "ABC", alice.addr, 500)
+
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenTransfer, bob.addr, 100, `{"token":"ABC"}`))
+	tc.balance(t, "ABC", alice.addr, 400)
+	tc.balance(t, "ABC", bob.addr, 100)
+
+	tc.reject(t, bob, bob.tokenTx(t, modules.TxTokenMint, bob.addr, 1, `{"token":"ABC"}`), modules.ErrNotMinter)
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenMint, carol.addr, 500, `{"token":"ABC"}`))
+	tc.balance(t, "ABC", carol.addr, 500)
+	tc.reject(t, alice, alice.tokenTx(t, modules.TxTokenMint, carol.addr, 1, `{"token":"ABC"}`), modules.ErrSupplyCap)
+
+	tc.reject(t, bob, bob.tokenTx(t, modules.TxTokenBurn, "", 101, `{"token":"ABC"}`), modules.ErrTokenBalance)
+	tc.mine(t, bob.tokenTx(t, modules.TxTokenBurn, "", 40, `{"token":"ABC"}`))
+	tc.balance(t, "ABC", bob.addr, 60)
+	if token, _ := tc.tokens.Token("ABC"); token.Supply != 960 {
+		t.Errorf("supply %d after burn, want 960", token.Supply)
+	}
+
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenApprove, bob.addr, 80, `{"token":"ABC"}`))
+	if got := tc.tokens.Allowance("ABC", alice.addr, bob.addr); got != 80 {
+		t.Errorf("allowance %d, want 80", got)
+	}
+	from := `{"token":"ABC","owner":"` + alice.addr + `"}`
+	tc.mine(t, bob.tokenTx(t, modules.TxTokenTransferFrom, carol.addr, 60, from))
+	tc.balance(t, "ABC", alice.addr, 340)
+	tc.balance(t, "ABC", carol.addr, 560)
+	if got := tc.tokens.Allowance("ABC", alice.addr, bob.addr); got != 20 {
+		t.Errorf("allowance %d after transferFrom, want 20", got)
+	}
+	tc.reject(t, bob, bob.tokenTx(t, modules.TxTokenTransferFrom, carol.addr, 21, from), modules.ErrAllowance)
+	tc.reject(t, carol, carol.tokenTx(t, modules.TxTokenTransferFrom, carol.addr, 1, from), modules.ErrAllowance)
+
+	// approving 0 revokes
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenApprove, bob.addr, 0, `{"token":"ABC"}`))
+	tc.reject(t, bob, bob.tokenTx(t, modules.TxTokenTransferFrom, carol.addr, 1, from), modules.ErrAllowance)
+}
+
+func TestTokenCheckTx(t *testing.T) {
+	alice, bob := newAccount(t), newAccount(t)
+	tc := newTokenChain(t, alice, bob)
+	tc.mine(t, alice.tokenTx(t, modules.TxTokenCreate, "", 100, `{"token":"ABC"}`))
+
+	tests := []struct {
+		name   string
+		txType string
+		to     string
+		amount int
+		data   string
+		want   error
+	}{
+		{"bad data", modules.TxTokenTransfer, "", 1, `not json`, modules.ErrInvalidTokenArgs},
+		{"bad symbol", modules.TxTokenCreate, "", 1, `{"token":"abc"}`, modules.ErrInvalidTokenArgs},
+		{"existing symbol", modules.TxTokenCreate, "", 1, `{"token":"ABC"}`, modules.ErrTokenExists},
+		{"over cap at creation", modules.TxTokenCreate, "", 11, `{"token":"XYZ","cap":10}`, modules.ErrSupplyCap},
+		{"negative cap", modules.TxTokenCreate, "", 1, `{"token":"XYZ","cap":-1}`, modules.ErrInvalidTokenArgs},
+		{"bad minter", modules.TxTokenCreate, "", 1, `{"token":"XYZ","minter":"nobody"}`, modules.ErrInvalidAddress},
+		{"unknown token", modules.TxTokenTransfer, bob.addr, 1, `{"token":"XYZ"}`, modules.ErrUnknownToken},
+		{"bad recipient", modules.TxTokenTransfer, "bob", 1, `{"token":"ABC"}`, modules.ErrInvalidAddress},
+		{"zero amount", modules.TxTokenTransfer, bob.addr, 0, `{"token":"ABC"}`, core.ErrInvalidAmount},
+		{"over balance", modules.TxTokenTransfer, bob.addr, 101, `{"token":"ABC"}`, modules.ErrTokenBalance},
+		{"bad owner", modules.TxTokenTransferFrom, bob.addr, 1, `{"token":"ABC","owner":"alice"}`, modules.ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc.reject(t, alice, alice.tokenTx(t, tt.txType, tt.to, tt.amount, tt.data), tt.want)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"modular-blockchain-framework/core"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var errFaucetDisabled = errors.New("faucet disabled: the node has no faucet key")
+
+// faucet pays test coins out of an account funded in the genesis. Credits
+// are ordinary signed transfers, so every node derives the same state from
+// the blocks that include them.
+type faucet struct {
+	mu   sync.Mutex // serializes nonce assignment
+	key  *ecdsa.PrivateKey
+	addr string
+}
+
+// SetFaucetKey enables /api/faucet and /addBalance, paying from the account
+// of key. It needs a balance in the genesis to pay out.
+func (r *RPCServer) SetFaucetKey(key *ecdsa.PrivateKey) {
+	r.faucet = &faucet{key: key, addr: crypto.PubkeyToAddress(key.PublicKey).Hex()}
+}
+
+// fund sends amount from the faucet account to addr through the mempool and
+// returns the transaction. addr is credited once a block includes it.
+func (r *RPCServer) fund(addr string, amount int) (core.Transaction, error) {
+	f := r.faucet
+	if f == nil {
+		return core.Transaction{}, errFaucetDisabled
+	}
+	if !common.IsHexAddress(addr) {
+		return core.Transaction{}, errors.New("invalid address")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx := core.Transaction{
+		ChainID:  r.chain.ChainID(),
+		From:     f.addr,
+		To:       addr,
+		Amount:   amount,
+		Nonce:    r.mempool.PendingNonce(f.addr),
+		GasLimit: core.GasTransfer,
+		GasPrice: r.chain.MinGasPrice(),
+	}
+	if bal := r.chain.GetBalance(f.addr); bal < amount+tx.Fee() {
+		return core.Transaction{}, fmt.Errorf("faucet is dry: balance %d", bal)
+	}
+	sig, err := crypto.Sign(tx.SigningHash(), f.key)
+	if err != nil {
+		return core.Transaction{}, err
+	}
+	tx.Signature = hexutil.Encode(sig)
+	return tx, r.mempool.Push(tx)
+}
+
+func faucetStatus(err error) int {
+	if errors.Is(err, errFaucetDisabled) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
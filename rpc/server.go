@@ -1,19 +1,17 @@
 package rpc
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"modular-blockchain-framework/consensus"
 	"modular-blockchain-framework/core"
-	"modular-blockchain-framework/db"
+	"modular-blockchain-framework/modules"
 	"net/http"
 	"os"
-	"strings"
 	"sync"
 	"time"
-
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 var faucetRequests = struct {
@@ -67,66 +65,67 @@ func enableCORS(next http.Handler) http.Handler {
 type RPCServer struct {
 	chain   *core.Chain
 	mempool *core.Mempool
+	engine  consensus.ConsensusEngine
+	tokens  *modules.TokenModule
+	faucet  *faucet // nil if disabled
+
+	mu  sync.Mutex
+	srv *http.Server
 }
 
 func New(chain *core.Chain, mempool *core.Mempool) *RPCServer {
 	return &RPCServer{chain: chain, mempool: mempool}
 }
 
-func VerifySignature(address string, message []byte, sigHex string) (bool, error) {
-	sig, err := hexutil.Decode(sigHex)
-	if err != nil {
-		return false, err
-	}
-	pubKey, err := crypto.Ecrecover(crypto.Keccak256(message), sig)
-	if err != nil {
-		return false, err
-	}
-	pk, err := crypto.UnmarshalPubkey(pubKey)
-	if err != nil {
-		return false, err
-	}
-	recoveredAddr := crypto.PubkeyToAddress(*pk).Hex()
-	return strings.EqualFold(recoveredAddr, address), nil
+// SetEngine exposes engine-specific endpoints such as /minerStats.
+func (r *RPCServer) SetEngine(e consensus.ConsensusEngine) {
+	r.engine = e
 }
 
-func (r *RPCServer) ValidateTx(tx *core.Transaction) error {
-	// Check balance
-	balance := r.chain.GetBalance(tx.From)
-	if balance < tx.Amount {
-		return fmt.Errorf("insufficient balance: have %d, need %d", balance, tx.Amount)
-	}
-
-	// Check amount is positive
-	if tx.Amount <= 0 {
-		return fmt.Errorf("amount must be positive")
-	}
+// SetTokens exposes the token module's balances and metadata.
+func (r *RPCServer) SetTokens(m *modules.TokenModule) {
+	r.tokens = m
+}
 
-	// Check nonce (prevent replay attacks)
-	currentNonce := r.chain.GetNonce(tx.From)
-	if tx.Nonce <= currentNonce {
-		return fmt.Errorf("invalid nonce: got %d, expected > %d", tx.Nonce, currentNonce)
-	}
+// ValidateTx checks tx against the head state: chain ID, amount, type, signature,
+// nonce and the balance or stake it spends.
+func (r *RPCServer) ValidateTx(tx *core.Transaction) error {
+	return r.chain.CheckTx(tx)
+}
 
-	// Verify signature
-	if tx.Signature == "" {
-		return fmt.Errorf("missing signature")
+// addBlock adds a block received from a peer. A chain that could not
+// restore its state after a failed reorg is beyond repair, so the node exits.
+func (r *RPCServer) addBlock(b core.Block) error {
+	err := r.chain.AddBlock(b)
+	if errors.Is(err, core.ErrStateCorrupted) {
+		log.Fatalf("fatal: %v", err)
 	}
+	return err
+}
 
-	// Create message for signing: JSON.stringify({from,to,amount,nonce})
-	message := fmt.Sprintf(`{"from":"%s","to":"%s","amount":%d,"nonce":%d}`, tx.From, tx.To, tx.Amount, tx.Nonce)
-	valid, err := VerifySignature(tx.From, []byte(message), tx.Signature)
-	if err != nil {
-		return fmt.Errorf("signature verification error: %v", err)
+// Start serves the RPC API on addr and blocks until the server stops. An empty
+// addr falls back to the PORT environment variable, then :8080.
+func (r *RPCServer) Start(addr string) error {
+	if addr == "" {
+		// listen on all interfaces (Docker-friendly)
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		addr = ":" + port
 	}
-	if !valid {
-		return fmt.Errorf("invalid signature")
+	srv := &http.Server{Addr: addr, Handler: r.Handler()}
+	r.mu.Lock()
+	r.srv = srv
+	r.mu.Unlock()
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
-
 	return nil
 }
 
-func (r *RPCServer) Start(addr string) {
+// Handler returns the RPC API as an http.Handler.
+func (r *RPCServer) Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	// root handler
@@ -138,11 +137,61 @@ func (r *RPCServer) Start(addr string) {
 		})
 	})
 
-	// get balance
+	// get balance, with token balances if the token module is enabled;
+	// ?token=<symbol> returns that token's balance instead
 	mux.HandleFunc("/balance", func(w http.ResponseWriter, req *http.Request) {
 		q := req.URL.Query().Get("addr")
-		bal := r.chain.GetBalance(q)
-		json.NewEncoder(w).Encode(map[string]interface{}{"address": q, "balance": bal})
+		if r.tokens == nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{"address": q, "balance": r.chain.GetBalance(q)})
+			return
+		}
+		balances := r.tokens.Balances(q)
+		if symbol := req.URL.Query().Get("token"); symbol != "" {
+			if _, ok := r.tokens.Token(symbol); !ok {
+				http.Error(w, "unknown token", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"address": q, "token": symbol, "balance": balances[symbol]})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"address": q, "balance": r.chain.GetBalance(q), "tokens": balances})
+	})
+
+	// token metadata and supply: every token, or one with ?symbol=
+	mux.HandleFunc("/tokens", func(w http.ResponseWriter, req *http.Request) {
+		if r.tokens == nil {
+			http.Error(w, "token module not enabled", http.StatusNotFound)
+			return
+		}
+		if symbol := req.URL.Query().Get("symbol"); symbol != "" {
+			token, ok := r.tokens.Token(symbol)
+			if !ok {
+				http.Error(w, "unknown token", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(token)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tokens": r.tokens.Tokens()})
+	})
+
+	// how much of owner's token balance spender may transfer
+	mux.HandleFunc("/allowance", func(w http.ResponseWriter, req *http.Request) {
+		if r.tokens == nil {
+			http.Error(w, "token module not enabled", http.StatusNotFound)
+			return
+		}
+		q := req.URL.Query()
+		if q.Get("token") == "" || q.Get("owner") == "" || q.Get("spender") == "" {
+			http.Error(w, "token, owner and spender are required", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":     q.Get("token"),
+			"owner":     q.Get("owner"),
+			"spender":   q.Get("spender"),
+			"allowance": r.tokens.Allowance(q.Get("token"), q.Get("owner"), q.Get("spender")),
+		})
 	})
 
 	// submit transaction
@@ -152,24 +201,50 @@ func (r *RPCServer) Start(addr string) {
 			http.Error(w, "invalid body", 400)
 			return
 		}
-		// server-side: verify signature + nonce + balance (function ValidateTx)
-		if err := r.ValidateTx(&tx); err != nil {
+		// server-side: verify signature + nonce + balance (function ValidateTx);
+		// a tx ahead of the account's nonce is queued until the gap is filled
+		if err := r.ValidateTx(&tx); err != nil && !errors.Is(err, core.ErrNonceGap) {
 			http.Error(w, err.Error(), 400)
 			return
 		}
-		r.mempool.Push(tx)
+		if err := r.mempool.Push(tx); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
 	})
 
-	// get mempool
+	// get mempool: pending transactions in block order, then queued ones
 	mux.HandleFunc("/mempool", func(w http.ResponseWriter, req *http.Request) {
-		r.mempool.Mu.RLock()
-		txs := make([]core.Transaction, len(r.mempool.Txs))
-		copy(txs, r.mempool.Txs)
-		r.mempool.Mu.RUnlock()
+		txs := r.mempool.PendingTransactions()
+		for _, queued := range r.mempool.Queued() {
+			txs = append(txs, queued...)
+		}
+		if txs == nil {
+			txs = []core.Transaction{}
+		}
 		json.NewEncoder(w).Encode(txs)
 	})
 
+	// mempool by sender, split into pending and queued
+	mux.HandleFunc("/mempoolContent", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"pending": r.mempool.Pending(),
+			"queued":  r.mempool.Queued(),
+		})
+	})
+
+	// chain ID transactions must be signed for
+	mux.HandleFunc("/chainId", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]uint64{"chainId": r.chain.ChainID()})
+	})
+
+	// nonce the next transaction from addr should use
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query().Get("addr")
+		json.NewEncoder(w).Encode(map[string]interface{}{"address": q, "nonce": r.mempool.PendingNonce(q)})
+	})
+
 	// health endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -189,8 +264,10 @@ func (r *RPCServer) Start(addr string) {
 			http.Error(w, "invalid block", 400)
 			return
 		}
-		// Add block to chain (basic implementation)
-		r.chain.AddBlock(block)
+		if err := r.addBlock(block); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]string{"status": "received"})
 	})
 
@@ -201,12 +278,14 @@ func (r *RPCServer) Start(addr string) {
 			http.Error(w, "invalid block", 400)
 			return
 		}
-		// Add block to chain
-		r.chain.AddBlock(block)
+		if err := r.addBlock(block); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
 	})
 
-	// addBalance endpoint
+	// addBalance endpoint: sends amount from the faucet account
 	mux.HandleFunc("/addBalance", func(w http.ResponseWriter, req *http.Request) {
 		if req.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -222,41 +301,23 @@ func (r *RPCServer) Start(addr string) {
 			return
 		}
 
-		newBalance := r.chain.AddBalance(rb.UserId, rb.Amount)
-		if err := db.UpsertWalletBalance(rb.UserId, newBalance); err != nil {
-			log.Println("warning: failed to persist wallet balance:", err)
+		tx, err := r.fund(rb.UserId, rb.Amount)
+		if err != nil {
+			http.Error(w, err.Error(), faucetStatus(err))
+			return
 		}
 
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":    true,
-			"newBalance": newBalance,
+			"success": true,
+			"txId":    tx.ID(),
+			"balance": r.chain.GetBalance(rb.UserId),
 		})
 	})
 
-	// resetBalance endpoint
+	// resetBalance endpoint: balances only change through transactions, so a
+	// node cannot set one by itself
 	mux.HandleFunc("/api/resetBalance", func(w http.ResponseWriter, req *http.Request) {
-		if req.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		type reqBody struct {
-			Address string `json:"address"`
-		}
-		var rb reqBody
-		if err := json.NewDecoder(req.Body).Decode(&rb); err != nil || rb.Address == "" {
-			http.Error(w, "invalid body", http.StatusBadRequest)
-			return
-		}
-
-		newBalance := r.chain.SetBalance(rb.Address, 0)
-		if err := db.UpsertWalletBalance(rb.Address, newBalance); err != nil {
-			log.Println("warning: failed to persist wallet balance:", err)
-		}
-
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success":    true,
-			"newBalance": newBalance,
-		})
+		http.Error(w, "balances can only be changed by transactions", http.StatusGone)
 	})
 
 	// faucet endpoint
@@ -289,36 +350,230 @@ func (r *RPCServer) Start(addr string) {
 			http.Error(w, `{"error":"Please wait 1 minute between faucet requests"}`, http.StatusTooManyRequests)
 			return
 		}
-		faucetRequests.last[reqBody.Address] = time.Now()
-		faucetRequests.mu.Unlock()
-
 		faucetAmount := 50
-		newBalance := r.chain.AddBalance(reqBody.Address, faucetAmount)
-		if err := db.UpsertWalletBalance(reqBody.Address, newBalance); err != nil {
-			log.Println("warning: failed to persist wallet balance:", err)
+		tx, err := r.fund(reqBody.Address, faucetAmount)
+		if err == nil {
+			faucetRequests.last[reqBody.Address] = time.Now()
+		}
+		faucetRequests.mu.Unlock()
+		if err != nil {
+			errBody, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(errBody), faucetStatus(err))
+			return
 		}
 
 		resp := map[string]interface{}{
 			"address": reqBody.Address,
 			"amount":  faucetAmount,
-			"balance": newBalance,
-			"status":  "ok",
+			"txId":    tx.ID(),
+			"balance": r.chain.GetBalance(reqBody.Address),
+			"status":  "pending",
 		}
 
 		json.NewEncoder(w).Encode(resp)
 	})
 
+	// Merkle inclusion proof for a mined transaction
+	mux.HandleFunc("/txProof", func(w http.ResponseWriter, req *http.Request) {
+		id := req.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "id is required", http.StatusBadRequest)
+			return
+		}
+		block, index, err := r.chain.FindTransaction(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		proof, err := core.MerkleProof(block.TxIDs(), index)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"txId":        id,
+			"blockNumber": block.Number,
+			"blockHash":   block.Hash,
+			"txRoot":      block.TxRoot,
+			"index":       index,
+			"proof":       proof,
+		})
+	})
+
+	// balance and nonce at a canonical block (?block=<hash>, default the head)
+	// with their proof against its state root
+	mux.HandleFunc("/balanceProof", func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("addr") == "" {
+			http.Error(w, "addr is required", http.StatusBadRequest)
+			return
+		}
+		proof, err := r.chain.ProveAccount(q.Get("addr"), q.Get("block"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(proof)
+	})
+
+	// PoW hash rate statistics
+	mux.HandleFunc("/minerStats", func(w http.ResponseWriter, req *http.Request) {
+		miner, ok := r.engine.(interface{ MinerStats() consensus.MinerStats })
+		if !ok {
+			http.Error(w, "consensus engine does not mine", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(miner.MinerStats())
+	})
+
+	// PoA validator set at the head
+	mux.HandleFunc("/validators", func(w http.ResponseWriter, req *http.Request) {
+		poa, ok := r.engine.(interface{ Validators() ([]string, error) })
+		if !ok {
+			http.Error(w, "consensus engine has no validators", http.StatusNotFound)
+			return
+		}
+		validators, err := poa.Validators()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"validators": validators})
+	})
+
+	// PoA vote to add or remove a validator in blocks this node seals
+	mux.HandleFunc("/propose", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		poa, ok := r.engine.(interface {
+			Propose(addr string, authorize bool) error
+		})
+		if !ok {
+			http.Error(w, "consensus engine does not vote", http.StatusNotFound)
+			return
+		}
+		var rb struct {
+			Address   string `json:"address"`
+			Authorize bool   `json:"authorize"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&rb); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		if err := poa.Propose(rb.Address, rb.Authorize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "proposed"})
+	})
+
+	// BFT consensus messages from other validators
+	mux.HandleFunc("/bftMessage", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bft, ok := r.engine.(interface{ HandleMessage(consensus.BFTMessage) })
+		if !ok {
+			http.Error(w, "consensus engine does not take messages", http.StatusNotFound)
+			return
+		}
+		var m consensus.BFTMessage
+		if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		bft.HandleMessage(m)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// dev engine: seal blocks now, optionally at a given timestamp
+	mux.HandleFunc("/dev_mine", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		dev, ok := r.engine.(*consensus.Dev)
+		if !ok {
+			http.Error(w, "consensus engine is not dev", http.StatusNotFound)
+			return
+		}
+		rb := struct {
+			Blocks    int   `json:"blocks"`
+			Timestamp int64 `json:"timestamp"`
+		}{Blocks: 1}
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(req.Body).Decode(&rb); err != nil {
+				http.Error(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		if rb.Blocks < 1 || rb.Blocks > 1000 {
+			http.Error(w, "blocks must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		if rb.Timestamp != 0 {
+			dev.SetTime(rb.Timestamp)
+		}
+		blocks, err := dev.Mine(rb.Blocks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(blocks)
+	})
+
+	// dev engine clock: GET reads it, POST pins it with "timestamp" or
+	// moves it forward by "increase" seconds
+	mux.HandleFunc("/dev_time", func(w http.ResponseWriter, req *http.Request) {
+		dev, ok := r.engine.(*consensus.Dev)
+		if !ok {
+			http.Error(w, "consensus engine is not dev", http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodPost {
+			var rb struct {
+				Timestamp int64 `json:"timestamp"`
+				Increase  int64 `json:"increase"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&rb); err != nil || rb.Increase < 0 {
+				http.Error(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+			if rb.Timestamp != 0 {
+				dev.SetTime(rb.Timestamp)
+			}
+			dev.IncreaseTime(time.Duration(rb.Increase) * time.Second)
+		}
+		json.NewEncoder(w).Encode(map[string]int64{"timestamp": dev.Now().Unix()})
+	})
+
+	// staking ledger at the head, or one address's stake with ?addr=
+	mux.HandleFunc("/staking", func(w http.ResponseWriter, req *http.Request) {
+		if addr := req.URL.Query().Get("addr"); addr != "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"address": addr, "stake": r.chain.GetStake(addr)})
+			return
+		}
+		json.NewEncoder(w).Encode(r.chain.Staking())
+	})
+
 	// get blocks
 	mux.HandleFunc("/blocks", func(w http.ResponseWriter, req *http.Request) {
-		blocks := make([]core.Block, len(r.chain.Blocks))
-		copy(blocks, r.chain.Blocks)
-		json.NewEncoder(w).Encode(blocks)
+		json.NewEncoder(w).Encode(r.chain.CanonicalBlocks())
 	})
 
-	// listen on all interfaces (Docker-friendly)
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	return enableCORS(mux)
+}
+
+// Shutdown stops accepting requests and waits for in-flight ones to finish.
+func (r *RPCServer) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	srv := r.srv
+	r.mu.Unlock()
+	if srv == nil {
+		return nil
 	}
-	http.ListenAndServe(":"+port, enableCORS(mux))
+	return srv.Shutdown(ctx)
 }
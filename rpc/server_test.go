@@ -0,0 +1,109 @@
+package rpc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"modular-blockchain-framework/consensus"
+	"modular-blockchain-framework/core"
+	"modular-blockchain-framework/modules"
+	"modular-blockchain-framework/rpc"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestBalanceTokens(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	g := core.DefaultGenesis()
+	g.Alloc[addr] = 1000
+	c := core.NewChainWithGenesis(g)
+	mm := modules.NewManager()
+	tokens := &modules.TokenModule{}
+	if err := mm.Register(tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := mm.Init(c); err != nil {
+		t.Fatal(err)
+	}
+	m := core.NewMempool()
+	dev := consensus.NewDev(c, m, consensus.DefaultDevConfig())
+	mine := func(txType, data string, nonce uint64, amount int) {
+		t.Helper()
+		tx := core.Transaction{ChainID: core.DefaultChainID, From: addr, Amount: amount, Type: txType, Data: data,
+			Nonce: nonce, GasLimit: core.GasTransfer, GasPrice: 1}
+		sig, err := crypto.Sign(tx.SigningHash(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Signature = hexutil.Encode(sig)
+		if err := m.Push(tx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dev.Mine(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mine(modules.TxTokenCreate, `{"token":"ABC"}`, 1, 100)
+	mine(modules.TxTokenCreate, `{"token":"XYZ"}`, 2, 200)
+	mine(modules.TxTokenCreate, `{"token":"NIL"}`, 3, 300)
+	// a token the address holds none of is left out of its map
+	mine(modules.TxTokenBurn, `{"token":"NIL"}`, 4, 300)
+
+	get := func(h http.Handler, url string, want int, out any) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != want {
+			t.Fatalf("GET %s: status %d, want %d", url, rec.Code, want)
+		}
+		if out != nil {
+			if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	server := rpc.New(c, m)
+	server.SetTokens(tokens)
+	h := server.Handler()
+
+	var all struct {
+		Balance int
+		Tokens  map[string]int
+	}
+	get(h, "/balance?addr="+addr, http.StatusOK, &all)
+	if all.Balance != c.GetBalance(addr) {
+		t.Errorf("balance %d, want %d", all.Balance, c.GetBalance(addr))
+	}
+	if len(all.Tokens) != 2 || all.Tokens["ABC"] != 100 || all.Tokens["XYZ"] != 200 {
+		t.Errorf("tokens %v, want ABC 100 and XYZ 200", all.Tokens)
+	}
+
+	var one struct {
+		Token   string
+		Balance int
+	}
+	get(h, "/balance?addr="+addr+"&token=XYZ", http.StatusOK, &one)
+	if one.Token != "XYZ" || one.Balance != 200 {
+		t.Errorf("got %+v, want XYZ 200", one)
+	}
+	get(h, "/balance?addr="+addr+"&token=NIL", http.StatusOK, &one)
+	if one.Balance != 0 {
+		t.Errorf("NIL balance %d, want 0", one.Balance)
+	}
+	get(h, "/balance?addr="+addr+"&token=NONE", http.StatusNotFound, nil)
+
+	// without the token module there is no map
+	var plain map[string]any
+	get(rpc.New(c, m).Handler(), "/balance?addr="+addr, http.StatusOK, &plain)
+	if _, ok := plain["tokens"]; ok {
+		t.Errorf("tokens served without the token module: %v", plain)
+	}
+}